@@ -0,0 +1,188 @@
+// Package apperrors holds the typed errors handlers and middleware return,
+// they are rendered as RFC 7807 problem details by the HTTP error handler.
+package apperrors
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/utils"
+)
+
+// Kind classifies an error, each kind maps to one HTTP status and problem
+// type.
+type Kind string
+
+const (
+	KindBadRequest           Kind = "bad-request"
+	KindValidation           Kind = "validation-error"
+	KindUnauthorized         Kind = "unauthorized"
+	KindForbidden            Kind = "forbidden"
+	KindNotFound             Kind = "not-found"
+	KindMethodNotAllowed     Kind = "method-not-allowed"
+	KindConflict             Kind = "conflict"
+	KindGone                 Kind = "gone"
+	KindPayloadTooLarge      Kind = "payload-too-large"
+	KindUnsupportedMediaType Kind = "unsupported-media-type"
+	KindTooManyRequests      Kind = "too-many-requests"
+	KindInternal             Kind = "internal-error"
+	KindUnavailable          Kind = "service-unavailable"
+	KindBadGateway           Kind = "bad-gateway"
+	KindTimeout              Kind = "gateway-timeout"
+)
+
+var kindStatus = map[Kind]int{
+	KindBadRequest:           http.StatusBadRequest,
+	KindValidation:           http.StatusBadRequest,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindNotFound:             http.StatusNotFound,
+	KindMethodNotAllowed:     http.StatusMethodNotAllowed,
+	KindConflict:             http.StatusConflict,
+	KindGone:                 http.StatusGone,
+	KindPayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindTooManyRequests:      http.StatusTooManyRequests,
+	KindInternal:             http.StatusInternalServerError,
+	KindUnavailable:          http.StatusServiceUnavailable,
+	KindBadGateway:           http.StatusBadGateway,
+	KindTimeout:              http.StatusGatewayTimeout,
+}
+
+var kindTitle = map[Kind]string{
+	KindValidation: "Validation failed",
+	KindInternal:   "Internal server error",
+}
+
+// Error is an error meant for the client. Detail is shown as is, Err is
+// the underlying cause and only ever logged.
+type Error struct {
+	Kind   Kind
+	Detail string
+	Fields []utils.FieldError
+	// Extensions are extra members added to the problem, such as the hops
+	// of a failed URL resolution.
+	Extensions map[string]interface{}
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Status() int {
+	if status, ok := kindStatus[e.Kind]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (e *Error) Title() string {
+	if title, ok := kindTitle[e.Kind]; ok {
+		return title
+	}
+
+	return http.StatusText(e.Status())
+}
+
+// With adds an extension member to the problem.
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]interface{})
+	}
+	e.Extensions[key] = value
+	return e
+}
+
+// Wrap keeps err as the logged cause.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func New(kind Kind, detail string) *Error {
+	return &Error{Kind: kind, Detail: detail}
+}
+
+func BadRequest(detail string) *Error {
+	return New(KindBadRequest, detail)
+}
+
+// Validation reports invalid fields, the rules come from utils.FieldError.
+func Validation(fields []utils.FieldError) *Error {
+	return &Error{Kind: KindValidation, Detail: "one or more fields are invalid", Fields: fields}
+}
+
+func Unauthorized(detail string) *Error {
+	return New(KindUnauthorized, detail)
+}
+
+func Forbidden(detail string) *Error {
+	return New(KindForbidden, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(KindNotFound, detail)
+}
+
+func Conflict(detail string) *Error {
+	return New(KindConflict, detail)
+}
+
+func Gone(detail string) *Error {
+	return New(KindGone, detail)
+}
+
+func PayloadTooLarge(detail string) *Error {
+	return New(KindPayloadTooLarge, detail)
+}
+
+func UnsupportedMediaType(detail string) *Error {
+	return New(KindUnsupportedMediaType, detail)
+}
+
+func TooManyRequests(detail string) *Error {
+	return New(KindTooManyRequests, detail)
+}
+
+func Unavailable(detail string) *Error {
+	return New(KindUnavailable, detail)
+}
+
+func BadGateway(detail string) *Error {
+	return New(KindBadGateway, detail)
+}
+
+func Timeout(detail string) *Error {
+	return New(KindTimeout, detail)
+}
+
+// Internal hides err from the client behind detail, err is logged.
+func Internal(err error, detail string) *Error {
+	return &Error{Kind: KindInternal, Detail: detail, Err: err}
+}
+
+// From returns err as an *Error, translating validation errors, and nil
+// when err carries no client-facing meaning.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var verr utils.ValidationError
+	if errors.As(err, &verr) {
+		return Validation(verr.Errors)
+	}
+
+	return nil
+}
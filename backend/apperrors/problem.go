@@ -0,0 +1,64 @@
+package apperrors
+
+import (
+	"encoding/json"
+
+	"github.com/goesbams/mini-books-library/backend/utils"
+)
+
+// ContentType is the media type of RFC 7807 problem details.
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the kind to build the problem type URI, a relative
+// reference resolved against the API address.
+const typeBase = "/problems/"
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []utils.FieldError `json:"errors,omitempty"`
+	// Extensions are flattened into the document next to the standard members.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// NewProblem describes err for the request at instance.
+func NewProblem(err *Error, instance, requestID string) Problem {
+	return Problem{
+		Type:       typeBase + string(err.Kind),
+		Title:      err.Title(),
+		Status:     err.Status(),
+		Detail:     err.Detail,
+		Instance:   instance,
+		RequestID:  requestID,
+		Errors:     err.Fields,
+		Extensions: err.Extensions,
+	}
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	standard, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions)+7)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	// standard members always win over an extension of the same name
+	var fields map[string]interface{}
+	if err := json.Unmarshal(standard, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		members[key] = value
+	}
+
+	return json.Marshal(members)
+}
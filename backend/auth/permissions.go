@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleLibrarian Role = "librarian"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermBooksWrite    Permission = "books:write"
+	PermBooksDelete   Permission = "books:delete"
+	PermMembersManage Permission = "members:manage"
+	PermUrlsProcess   Permission = "urls:process"
+	PermAPIKeysManage Permission = "api-keys:manage"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("permission denied")
+)
+
+// rolePermissions grants each role its permissions, every role includes
+// those of the roles below it.
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:    {PermUrlsProcess},
+	RoleLibrarian: {PermUrlsProcess, PermBooksWrite},
+	RoleAdmin:     {PermUrlsProcess, PermBooksWrite, PermBooksDelete, PermMembersManage, PermAPIKeysManage},
+}
+
+// apiKeyScopes are the permissions an API key may be granted, managing keys
+// and accounts stays with staff users.
+var apiKeyScopes = []Permission{PermUrlsProcess, PermBooksWrite, PermBooksDelete}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, expected viewer, librarian or admin", s)
+	}
+
+	return role, nil
+}
+
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ParseScope(s string) (Permission, error) {
+	for _, scope := range apiKeyScopes {
+		if Permission(s) == scope {
+			return scope, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown scope %q", s)
+}
+
+func (p Principal) Can(permission Permission) bool {
+	if p.IsAPIKey() {
+		for _, scope := range p.Scopes {
+			if scope == permission {
+				return true
+			}
+		}
+		return false
+	}
+
+	return p.Role.Can(permission)
+}
+
+// Require returns ErrForbidden, wrapped with the missing permission, when
+// principal lacks it.
+func Require(principal Principal, permission Permission) error {
+	if !principal.Can(permission) {
+		return fmt.Errorf("%w: %s required", ErrForbidden, permission)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package auth holds the identity of a request along with the password and
+// token primitives used to establish it.
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Principal is the authenticated caller of a request, either a staff user
+// holding an access JWT or an API key.
+type Principal struct {
+	UserID int
+	Email  string
+	Role   Role
+	// TokenID is the jti of the access token, used to revoke it on logout.
+	TokenID   string
+	ExpiresAt time.Time
+
+	// APIKeyID is set for API keys, which are limited to their Scopes
+	// instead of a role.
+	APIKeyID int
+	Scopes   []Permission
+}
+
+func (p Principal) IsAPIKey() bool {
+	return p.APIKeyID != 0
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal attached by the auth
+// middleware, ok is false for anonymous requests.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestIssuer(t *testing.T, secret, issuer string, ttl time.Duration) *TokenIssuer {
+	t.Helper()
+
+	tokens, err := NewTokenIssuer(secret, issuer, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestTokenIssuerRoundTrip(t *testing.T) {
+	tokens := newTestIssuer(t, testSecret, "library", time.Minute)
+
+	signed, issued, err := tokens.Issue(7, "ada@example.com", RoleLibrarian)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	principal, err := tokens.Parse(signed)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if principal.UserID != 7 || principal.Email != "ada@example.com" || principal.Role != RoleLibrarian {
+		t.Errorf("principal = %+v", principal)
+	}
+	if principal.TokenID == "" || principal.TokenID != issued.TokenID {
+		t.Errorf("token id %q, issued %q", principal.TokenID, issued.TokenID)
+	}
+	if !principal.ExpiresAt.Equal(issued.ExpiresAt.Truncate(time.Second)) {
+		t.Errorf("expires at %s, issued %s", principal.ExpiresAt, issued.ExpiresAt)
+	}
+
+	other, _, _ := tokens.Issue(7, "ada@example.com", RoleLibrarian)
+	if other == signed {
+		t.Error("two tokens share the same id")
+	}
+}
+
+func TestTokenIssuerRejects(t *testing.T) {
+	tokens := newTestIssuer(t, testSecret, "library", time.Minute)
+	valid, _, err := tokens.Issue(7, "ada@example.com", RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims accessClaims) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	claims := func(role Role, subject string, expiresAt time.Time) accessClaims {
+		return accessClaims{Role: role, RegisteredClaims: jwt.RegisteredClaims{
+			ID: "jti", Issuer: "library", Subject: subject, ExpiresAt: jwt.NewNumericDate(expiresAt),
+		}}
+	}
+	later := time.Now().Add(time.Minute)
+
+	header, payload, _ := strings.Cut(valid, ".")
+	payload, signature, _ := strings.Cut(payload, ".")
+	adminPayload := jwtSegment(t, claims(RoleAdmin, "7", later))
+
+	tests := map[string]string{
+		"expired":            mustIssue(t, newTestIssuer(t, testSecret, "library", -time.Minute)),
+		"other secret":       mustIssue(t, newTestIssuer(t, strings.Repeat("x", 32), "library", time.Minute)),
+		"other issuer":       mustIssue(t, newTestIssuer(t, testSecret, "elsewhere", time.Minute)),
+		"tampered payload":   header + "." + adminPayload + "." + signature,
+		"missing signature":  header + "." + payload + ".",
+		"unsigned":           sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(RoleAdmin, "7", later)),
+		"other algorithm":    sign(jwt.SigningMethodHS512, []byte(testSecret), claims(RoleAdmin, "7", later)),
+		"no expiry":          sign(jwt.SigningMethodHS256, []byte(testSecret), accessClaims{Role: RoleAdmin, RegisteredClaims: jwt.RegisteredClaims{ID: "jti", Issuer: "library", Subject: "7"}}),
+		"subject not an id":  sign(jwt.SigningMethodHS256, []byte(testSecret), claims(RoleAdmin, "ada", later)),
+		"unknown role":       sign(jwt.SigningMethodHS256, []byte(testSecret), claims("root", "7", later)),
+		"not a token at all": "Bearer nothing",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tokens.Parse(token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Parse = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestNewTokenIssuerRequiresLongSecret(t *testing.T) {
+	if _, err := NewTokenIssuer(testSecret[:31], "library", time.Minute); err == nil {
+		t.Error("NewTokenIssuer accepted a 31 character secret")
+	}
+}
+
+func mustIssue(t *testing.T, tokens *TokenIssuer) string {
+	t.Helper()
+
+	signed, _, err := tokens.Issue(7, "ada@example.com", RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// jwtSegment encodes claims the way a token payload is.
+func jwtSegment(t *testing.T, claims accessClaims) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("unrelated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(signed, ".")[1]
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+)
+
+// configCommand runs "config print", which writes the effective
+// configuration with secrets redacted and then reports whether it is valid.
+func configCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+
+	out, err := cfg.Redacted()
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+
+	return cfg.Validate()
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+var _ flag.Value = (*stringList)(nil)
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -1,17 +1,39 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
 	"github.com/goesbams/mini-books-library/backend/config"
 	"github.com/goesbams/mini-books-library/backend/database"
 	_ "github.com/goesbams/mini-books-library/backend/docs"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/health"
 	"github.com/goesbams/mini-books-library/backend/middleware"
+	"github.com/goesbams/mini-books-library/backend/migrations"
+	"github.com/goesbams/mini-books-library/backend/ratelimit"
+	"github.com/goesbams/mini-books-library/backend/storage"
 	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/goesbams/mini-books-library/backend/workers"
 	echoSwagger "github.com/swaggo/echo-swagger"
 
 	"github.com/goesbams/mini-books-library/backend/handlers"
+	"github.com/goesbams/mini-books-library/backend/metrics"
 	"github.com/goesbams/mini-books-library/backend/repositories"
 	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/goesbams/mini-books-library/backend/tracing"
 	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 )
 
 // @title Mini Books Library API
@@ -19,15 +41,61 @@ import (
 // @description This is a sample API for managing books in the library.
 // @contact.name Bambang Handoko (Ando)
 // @contact.email bambang.handoko12@gmail.com
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from POST /auth/login or an API key, sent as "Bearer <token>"
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key issued through POST /api-keys
 
 func main() {
+	// configuration layers: defaults, files, environment, then -set flags
+	var files, overrides stringList
+	env := flag.String("env", envOr("APP_ENV", "dev"), "environment, selects config/config.<env>.yaml")
+	flag.Var(&files, "config", "config file to load instead of the environment's, repeat to layer several")
+	flag.Var(&overrides, "set", "override a setting by its YAML path, as key=value (server.port=8080)")
+	flag.Parse()
+	args := flag.Args()
+
+	if len(files) == 0 {
+		files = config.EnvironmentFiles("config", *env)
+	}
+	sources := config.Sources{Files: files, Overrides: overrides}
+	cfg, err := config.Load(sources)
+	if err != nil {
+		logrus.Fatal("error loading config:", err)
+	}
+
+	// config print runs before validation to help fix an invalid config
+	if len(args) > 0 && args[0] == "config" {
+		if err := configCommand(cfg, args[1:]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		logrus.Fatal(err)
+	}
+
 	// initialize logger
-	logger := utils.InitializeLogger()
+	logger, err := utils.InitializeLogger(cfg.Log)
+	if err != nil {
+		logrus.Fatal("invalid log configuration:", err)
+	}
 
-	// load configuration
-	cfg, err := config.LoadConfig("config/config.dev.yaml")
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := migrateCommand(cfg, args[1:]); err != nil {
+			logger.Fatal("migrate failed:", err)
+		}
+		return
+	}
+
+	// initialize tracing, spans are dropped unless an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		logger.Fatal("error loading config:", err)
+		logger.Fatal("invalid tracing configuration:", err)
 	}
 
 	// initialize database connection
@@ -35,34 +103,356 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed to connect the database:", err)
 	}
+	if err := metrics.RegisterDB(conn); err != nil {
+		logger.Fatal("failed to register database metrics:", err)
+	}
+	migrator, err := database.NewMigrator(conn, migrations.FS)
+	if err != nil {
+		logger.Fatal("invalid migrations:", err)
+	}
+	if cfg.Database.AutoMigrate {
+		if err := migrator.Up(context.Background(), 0); err != nil {
+			logger.Fatal("failed to migrate the database:", err)
+		}
+	}
 
 	// setup repos & services
 	bookRepo := repositories.NewBookRepository()
-	bookService := services.NewBookService(bookRepo, conn)
-	urlService := services.NewUrlService()
+	var metadataProvider services.MetadataProvider
+	if cfg.Metadata.Enabled {
+		metadataProvider = services.NewOpenLibraryProvider(cfg.Metadata.BaseURL, cfg.Metadata.Timeout, cfg.Metadata.CacheTTL)
+	}
+	bookService := services.NewAuthorizedBookService(services.NewTracedBookService(services.NewBookService(bookRepo, conn, metadataProvider)))
+	redirector, err := services.NewRedirector(cfg.Urls.Redirect)
+	if err != nil {
+		logger.Fatal("invalid url redirect rules:", err)
+	}
+	trackingStripper := services.NewTrackingStripper(cfg.Urls.Tracking)
+	resolver := services.NewResolver(services.ResolverOptions{
+		MaxHops:         cfg.Urls.Resolve.MaxHops,
+		Timeout:         cfg.Urls.Resolve.Timeout,
+		FollowCanonical: cfg.Urls.Resolve.FollowCanonical,
+		AllowPrivate:    cfg.Urls.Resolve.AllowPrivate,
+	})
+	urlOperations, err := services.NewDefaultOperationRegistry(redirector, trackingStripper, resolver, cfg.Urls.Pipelines)
+	if err != nil {
+		logger.Fatal("invalid url pipelines:", err)
+	}
+	urlService := services.NewAuthorizedUrlService(services.NewUrlService(urlOperations, resolver))
+
+	// reload the tracking parameter lists on SIGHUP without a restart
+	reloadOnSignal(sources, func(cfg *config.Config) {
+		trackingStripper.Update(cfg.Urls.Tracking)
+	})
+
+	coverStore, err := newCoverStore(cfg)
+	if err != nil {
+		logger.Fatal("failed to initialize cover storage:", err)
+	}
+	coverCheckRepo := repositories.NewCoverCheckRepository()
+	coverService := services.NewCoverService(bookRepo, coverCheckRepo, conn, coverStore, cfg.Covers.MaxUploadSize, cfg.Covers.PublicBaseURL)
+
+	linkRepo := repositories.NewLinkRepository()
+	linkService := services.NewAuthorizedLinkService(services.NewLinkService(linkRepo, conn, cfg.Links.BaseURL))
+
+	tokenIssuer, err := auth.NewTokenIssuer(cfg.Auth.JWTSecret, cfg.Auth.Issuer, cfg.Auth.AccessTokenTTL)
+	if err != nil {
+		logger.Fatal("invalid auth configuration:", err)
+	}
+	userRepo := repositories.NewUserRepository()
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(), conn, tokenIssuer, cfg.Auth.RefreshTokenTTL)
+	userService := services.NewAuthorizedUserService(services.NewUserService(userRepo, conn))
+	apiKeyService := services.NewAuthorizedApiKeyService(services.NewApiKeyService(repositories.NewApiKeyRepository(), conn))
+
+	// one-off commands run instead of the server
+	if len(args) > 0 {
+		switch args[0] {
+		case "create-user":
+			if err := createUser(userService, args[1:]); err != nil {
+				logger.Fatal("failed to create user:", err)
+			}
+		default:
+			logger.Fatalf("unknown command %q", args[0])
+		}
+		return
+	}
+
+	// background jobs, stopped once the server has drained
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var runningWorkers sync.WaitGroup
+	if cfg.Covers.HealthCheck.Enabled {
+		// the checker mirrors covers outside any request, without a principal
+		// it gets the cover service undecorated
+		coverChecker := workers.NewCoverChecker(bookRepo, coverCheckRepo, coverService, conn, workers.CoverCheckerOptions{
+			Interval:        cfg.Covers.HealthCheck.Interval,
+			Timeout:         cfg.Covers.HealthCheck.Timeout,
+			Concurrency:     cfg.Covers.HealthCheck.Concurrency,
+			PerHostInterval: cfg.Covers.HealthCheck.PerHostInterval,
+			Mirror:          cfg.Covers.HealthCheck.Mirror,
+			SkipPrefix:      cfg.Covers.PublicBaseURL,
+		})
+		runningWorkers.Add(1)
+		go func() {
+			defer runningWorkers.Done()
+			coverChecker.Run(workersCtx)
+		}()
+	}
+
+	// readiness checks, optional ones only mark the service degraded
+	checks := health.NewRegistry(cfg.Health.Timeout)
+	checks.Register("database", database.PingCheck(conn))
+	checks.Register("migrations", database.MigrationCheck(conn, migrator))
 
 	// create echo instance
 	e := echo.New()
+	e.HTTPErrorHandler = middleware.HTTPErrorHandler
+	e.HideBanner = true
+	e.Server.ReadHeaderTimeout = cfg.Server.ReadHeaderTimeout
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
+	e.Server.IdleTimeout = cfg.Server.IdleTimeout
+
+	// request ID and access log first so every later line carries the ID
+	e.Use(middleware.RequestID())
+	e.Use(middleware.RequestLogger())
+	e.Use(middleware.Metrics())
+	e.Use(middleware.Tracing())
 
 	// CORS middleware
-	e.Use(middleware.CORS())
+	cors, err := middleware.CORS(cfg.CORS)
+	if err != nil {
+		logger.Fatal("invalid cors configuration:", err)
+	}
+	e.Use(cors)
+	// batches run longer, their route sets urls.batch.timeout instead
+	e.Use(middleware.Timeout(cfg.Server.RequestTimeout, "/urls/process/batch"))
+
+	// rate limits per route group
+	if cfg.RateLimit.TrustProxy {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+	rateLimit, err := newRateLimits(cfg.RateLimit, checks)
+	if err != nil {
+		logger.Fatal("invalid rate limit configuration:", err)
+	}
+	authLimit, readLimit, writeLimit, urlsLimit := rateLimit("auth"), rateLimit("read"), rateLimit("write"), rateLimit("urls")
+
+	// every token or API key check is a database lookup, limit callers by
+	// IP before authenticating so invalid credentials are throttled too
+	e.Use(rateLimit("ip"))
+	e.Use(middleware.Authenticate(authService, apiKeyService))
+	requireAuth := middleware.RequireAuth()
+	canWriteBooks := middleware.RequirePermission(auth.PermBooksWrite)
+	canDeleteBooks := middleware.RequirePermission(auth.PermBooksDelete)
+	canProcessUrls := middleware.RequirePermission(auth.PermUrlsProcess)
+	canManageMembers := middleware.RequirePermission(auth.PermMembersManage)
+	canManageApiKeys := middleware.RequirePermission(auth.PermAPIKeysManage)
 
 	// define handlers
 	bookHandler := handlers.NewBookHandler(bookService)
-	urlHandler := handlers.NewUrlHandler(urlService)
+	urlBatchProcessor := services.NewUrlBatchProcessor(urlService, cfg.Urls.Batch.Workers)
+	urlHandler := handlers.NewUrlHandler(urlService, urlBatchProcessor, cfg.Urls.Batch.MaxItems)
+	coverHandler := handlers.NewCoverHandler(services.NewAuthorizedCoverService(coverService), cfg.Covers.MaxUploadSize)
+	linkHandler := handlers.NewLinkHandler(linkService)
+	authHandler := handlers.NewAuthHandler(authService)
+	userHandler := handlers.NewUserHandler(userService)
+	apiKeyHandler := handlers.NewApiKeyHandler(apiKeyService)
+	healthHandler := handlers.NewHealthHandler(checks)
 
 	// Routes
-	e.GET("/books", bookHandler.GetBooks)
-	e.POST("books", bookHandler.AddBook)
-	e.GET("books/:id", bookHandler.GetBookById)
-	e.PUT("books/:id", bookHandler.UpdateBook)
-	e.DELETE("books/:id", bookHandler.DeleteBook)
+	e.GET("/healthz", healthHandler.Liveness)
+	e.GET("/readyz", healthHandler.Readiness)
+
+	e.POST("/auth/login", authHandler.Login, authLimit)
+	e.POST("/auth/refresh", authHandler.Refresh, authLimit)
+	e.POST("/auth/logout", authHandler.Logout, writeLimit, requireAuth)
+
+	e.GET("/users", userHandler.GetUsers, readLimit, canManageMembers)
+	e.POST("/users", userHandler.CreateUser, writeLimit, canManageMembers)
+	e.PUT("/users/:id/role", userHandler.UpdateUserRole, writeLimit, canManageMembers)
+
+	e.GET("/api-keys", apiKeyHandler.GetApiKeys, readLimit, canManageApiKeys)
+	e.POST("/api-keys", apiKeyHandler.CreateApiKey, writeLimit, canManageApiKeys)
+	e.DELETE("/api-keys/:id", apiKeyHandler.RevokeApiKey, writeLimit, canManageApiKeys)
 
-	e.POST("/urls/process", urlHandler.ProcessUrl)
+	e.GET("/books", bookHandler.GetBooks, readLimit)
+	e.POST("books", bookHandler.AddBook, writeLimit, canWriteBooks)
+	e.POST("books/lookup", bookHandler.LookupBook, writeLimit, canWriteBooks)
+	e.GET("books/:id", bookHandler.GetBookById, readLimit)
+	e.PUT("books/:id", bookHandler.UpdateBook, writeLimit, canWriteBooks)
+	e.DELETE("books/:id", bookHandler.DeleteBook, writeLimit, canDeleteBooks)
+
+	e.POST("books/:id/cover", coverHandler.UploadCover, writeLimit, canWriteBooks)
+	e.GET("books/:id/cover", coverHandler.GetCover, readLimit)
+	e.GET("books/:id/cover/:size", coverHandler.GetCoverThumbnail, readLimit)
+	e.GET("/covers/broken", coverHandler.GetBrokenCovers, readLimit, canWriteBooks)
+
+	e.POST("/urls/process", urlHandler.ProcessUrl, urlsLimit, canProcessUrls)
+	e.POST("/urls/process/batch", urlHandler.ProcessUrlBatch, urlsLimit, canProcessUrls, middleware.Timeout(cfg.Urls.Batch.Timeout))
+	e.GET("/urls/operations", urlHandler.GetOperations, readLimit)
+
+	e.POST("/links", linkHandler.CreateLink, urlsLimit, canProcessUrls)
+	e.GET("/links/:code/stats", linkHandler.GetLinkStats, readLimit, canProcessUrls)
+	e.GET("/s/:code", linkHandler.FollowLink, readLimit)
 
 	// Swagger UI route
 	e.GET("/swagger/*", echoSwagger.EchoWrapHandler())
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
+	// serve until SIGINT or SIGTERM, a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	exitCode := 0
+	if err := serve(ctx, e, cfg.Server.Addr(), cfg.Server, checks); err != nil {
+		logger.WithError(err).Error("server stopped")
+		exitCode = 1
+	}
+
+	stopWorkers()
+	runningWorkers.Wait()
+
+	if err := conn.Close(); err != nil {
+		logger.WithError(err).Error("failed to close the database")
+		exitCode = 1
+	}
+
+	// flush the spans still buffered before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.WithError(err).Error("failed to flush traces")
+		exitCode = 1
+	}
+	cancel()
+
+	os.Exit(exitCode)
+}
+
+// newRateLimits returns the rate limiting middleware of a route group, it
+// lets everything through when rate limiting is disabled. A Redis store is
+// checked for readiness as optional since limits fail open without it.
+func newRateLimits(cfg config.RateLimitConfig, checks *health.Registry) (func(group string) echo.MiddlewareFunc, error) {
+	if !cfg.Enabled {
+		return func(string) echo.MiddlewareFunc {
+			return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+		}, nil
+	}
+
+	var store ratelimit.Store
+	switch cfg.Store {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		checks.RegisterOptional("redis", health.CheckerFunc(func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		}))
+		store = ratelimit.NewRedisStore(client, "ratelimit:")
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.Store)
+	}
+
+	limits := make(map[string]ratelimit.Limit, len(cfg.Groups))
+	for group, rule := range cfg.Groups {
+		if rule.Requests <= 0 || rule.Per <= 0 {
+			return nil, fmt.Errorf("rate limit group %q: requests and per must be positive", group)
+		}
+		limits[group] = ratelimit.PerPeriod(rule.Requests, rule.Per, rule.Burst)
+	}
+
+	return func(group string) echo.MiddlewareFunc {
+		limit, ok := limits[group]
+		if !ok {
+			// route groups are fixed in code, a missing one is a programming error
+			panic(fmt.Sprintf("no rate limit for group %q", group))
+		}
+		return middleware.RateLimit(store, group, limit)
+	}, nil
+}
+
+func newCoverStore(cfg *config.Config) (storage.BlobStore, error) {
+	switch cfg.Covers.Storage {
+	case "local":
+		return storage.NewLocalStore(cfg.Covers.LocalPath)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.Covers.S3.Endpoint,
+			Region:    cfg.Covers.S3.Region,
+			Bucket:    cfg.Covers.S3.Bucket,
+			AccessKey: cfg.Covers.S3.AccessKey,
+			SecretKey: cfg.Covers.S3.SecretKey,
+			Timeout:   cfg.Covers.S3.Timeout,
+		})
+	default:
+		return nil, fmt.Errorf("unknown cover storage %q", cfg.Covers.Storage)
+	}
+}
+
+// reloadOnSignal reloads the configuration on every SIGHUP and hands it to
+// apply. A config that fails to load or validate leaves the running one in
+// place.
+func reloadOnSignal(sources config.Sources, apply func(cfg *config.Config)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			cfg, err := config.Load(sources)
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				logrus.WithError(err).Error("failed to reload config")
+				continue
+			}
+
+			apply(cfg)
+			logrus.Info("reloaded config")
+		}
+	}()
+}
+
+// createUser registers a staff account, the password is read from the first
+// line of stdin so it stays out of the shell history. It is how the first
+// admin gets created.
+func createUser(service services.UserServiceInterface, args []string) error {
+	flags := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the new account")
+	role := flags.String("role", string(auth.RoleViewer), "viewer, librarian or admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "password:")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("read password: %w", err)
+	}
+
+	// whoever runs the command holds the server's configuration, it acts
+	// as an admin
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Email: "create-user", Role: auth.RoleAdmin})
+	user, err := service.CreateUser(ctx, &entities.CreateUserRequest{
+		Email:    *email,
+		Password: strings.TrimRight(password, "\r\n"),
+		Role:     *role,
+	})
+	if err != nil {
+		if verr, ok := err.(utils.ValidationError); ok {
+			return fmt.Errorf("invalid %v", verr.Errors)
+		}
+		return err
+	}
 
-	// start server
-	e.Logger.Fatal(e.Start(":9000"))
+	logrus.Infof("created user id:%d email:%s role:%s", user.ID, user.Email, user.Role)
+	return nil
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/goesbams/mini-books-library/backend/database"
+	"github.com/goesbams/mini-books-library/backend/migrations"
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "usage: migrate up [N] | down [N] | status | goto VERSION | create [-dir DIR] NAME"
+
+// migrateCommand runs "migrate", which manages the schema with the
+// migrations embedded in the binary. create writes new migration files to
+// the source tree and doesn't need the database.
+func migrateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		flags := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+		dir := flags.String("dir", "migrations", "directory of the migration files")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		up, down, err := database.CreateMigration(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		logrus.Infof("created %s and %s", up, down)
+		return nil
+	}
+
+	conn, err := database.ConnectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	migrator, err := database.NewMigrator(conn, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		n, err := countArg(args[1:], 0)
+		if err != nil {
+			return err
+		}
+		return migrator.Up(ctx, n)
+	case "down":
+		// a single migration unless told otherwise, reverting is destructive
+		n, err := countArg(args[1:], 1)
+		if err != nil {
+			return err
+		}
+		return migrator.Down(ctx, n)
+	case "goto":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return migrator.Goto(ctx, uint(version))
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	}
+
+	return errors.New(migrateUsage)
+}
+
+func countArg(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || len(args) > 1 {
+		return 0, fmt.Errorf("invalid count %q, expected a positive number", args[0])
+	}
+	return n, nil
+}
+
+func printMigrationStatus(ctx context.Context, migrator *database.Migrator) error {
+	statuses, version, dirty, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d (latest %d)\n", version, migrator.Latest())
+	if dirty {
+		fmt.Println("dirty: the last migration failed halfway and needs fixing by hand")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state = "applied"
+		}
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case status.Drifted:
+			state += ", changed since applied"
+		case status.Untracked:
+			state += ", no checksum yet"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/goesbams/mini-books-library/backend/health"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// serve runs the server until ctx is done, then drains it: readiness fails
+// for DrainDelay so load balancers stop routing here, new connections are
+// refused and in-flight requests get ShutdownTimeout to complete. It only
+// returns an error when the server failed or didn't drain in time.
+func serve(ctx context.Context, e *echo.Echo, addr string, cfg config.ServerConfig, checks *health.Registry) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- e.Start(addr)
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("start server: %w", err)
+	case <-ctx.Done():
+	}
+
+	logrus.Info("shutting down, draining in-flight requests")
+	checks.Drain()
+	time.Sleep(cfg.DrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		// whatever is still running gets cut off
+		if closeErr := e.Close(); closeErr != nil {
+			logrus.WithError(closeErr).Error("failed to close connections")
+		}
+		return fmt.Errorf("drain requests: %w", err)
+	}
+
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	logrus.Info("server stopped")
+	return nil
+}
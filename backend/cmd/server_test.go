@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/goesbams/mini-books-library/backend/handlers"
+	"github.com/goesbams/mini-books-library/backend/health"
+	"github.com/labstack/echo/v4"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	const drainDelay = 300 * time.Millisecond
+
+	checks := health.NewRegistry(time.Second)
+	started := make(chan struct{})
+
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.GET("/readyz", handlers.NewHealthHandler(checks).Readiness)
+	e.GET("/slow", func(c echo.Context) error {
+		close(started)
+		time.Sleep(2 * drainDelay)
+		return c.String(http.StatusOK, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, e, "127.0.0.1:0", config.ServerConfig{DrainDelay: drainDelay, ShutdownTimeout: 5 * time.Second}, checks)
+	}()
+
+	base := "http://" + waitForListener(t, e)
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) (int, string, error) {
+		resp, err := client.Get(base + path)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), err
+	}
+
+	if status, _, err := get("/readyz"); err != nil || status != http.StatusOK {
+		t.Fatalf("readyz before shutdown = %d, %v, want 200", status, err)
+	}
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	slow := make(chan response, 1)
+	go func() {
+		status, body, err := get("/slow")
+		slow <- response{status, body, err}
+	}()
+
+	<-started
+	cancel()
+
+	// readiness fails while the server still accepts connections
+	deadline := time.Now().Add(drainDelay / 2)
+	for {
+		status, _, err := get("/readyz")
+		if err == nil && status == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readyz during the drain delay = %d, %v, want 503", status, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if res := <-slow; res.err != nil || res.status != http.StatusOK || res.body != "done" {
+		t.Errorf("in-flight request = %d %q, %v, want it completed with 200", res.status, res.body, res.err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve returned %v after a clean drain", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return")
+	}
+}
+
+func waitForListener(t *testing.T, e *echo.Echo) string {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		if addr := e.ListenerAddr(); addr != nil {
+			return addr.String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("server did not start")
+	return ""
+}
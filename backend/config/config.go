@@ -1,58 +1,404 @@
 package config
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"os"
+	"net"
+	"net/url"
 	"strconv"
-
-	"gopkg.in/yaml.v2"
+	"time"
 )
 
+// Config is the whole application configuration. Fields marked secret are
+// redacted by Redacted, validate tags are checked by Validate.
 type Config struct {
-	Database struct {
-		User     string `yaml:"user"`
-		Password string `yaml:"password"`
-		Host     string `yaml:"host"`
-		Port     int    `yaml:"port"`
-		Dbname   string `yaml:"dbname"`
-		Sslmode  string `yaml:"sslmode"`
-	} `yaml:"database"`
-}
-
-func LoadConfig(path string) (*Config, error) {
-	config := &Config{}
-
-	file, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Printf("Error reading config file (%v), falling back to environment variables", err)
-	} else {
-		err = yaml.Unmarshal(file, config)
-		if err != nil {
-			log.Printf("Error unmarshalling YAML from file (%v), falling back to environment variables", err)
-		}
+	Database  DatabaseConfig  `yaml:"database"`
+	Server    ServerConfig    `yaml:"server"`
+	Metadata  MetadataConfig  `yaml:"metadata"`
+	Covers    CoversConfig    `yaml:"covers"`
+	Urls      UrlsConfig      `yaml:"urls"`
+	Links     LinksConfig     `yaml:"links"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Health    HealthConfig    `yaml:"health"`
+	CORS      CORSConfig      `yaml:"cors"`
+}
 
-		return config, nil
-	}
+// CORSConfig configures which browser origins may call the API.
+type CORSConfig struct {
+	CORSPolicy `yaml:",inline"`
+	// Routes overrides the policy for paths starting with the key, the
+	// longest matching prefix wins. Settings left empty in an override are
+	// taken from the main policy, credentials excepted.
+	Routes map[string]CORSPolicy `yaml:"routes"`
+}
+
+type CORSPolicy struct {
+	// AllowOrigins lists the allowed origins, "https://*.example.com"
+	// matches any subdomain and "*" any origin. Nothing is allowed when
+	// empty.
+	AllowOrigins  []string `yaml:"allow_origins"`
+	AllowMethods  []string `yaml:"allow_methods"`
+	AllowHeaders  []string `yaml:"allow_headers"`
+	ExposeHeaders []string `yaml:"expose_headers"`
+	// AllowCredentials lets browsers send cookies, it can't be combined
+	// with "*" as origin.
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration `yaml:"max_age" validate:"gte=0"`
+}
+
+type DatabaseConfig struct {
+	// URL is a postgres:// DSN, the fields it sets win over the separate
+	// ones below.
+	URL      string `yaml:"url" secret:"true"`
+	User     string `yaml:"user" validate:"required"`
+	Password string `yaml:"password" secret:"true"`
+	Host     string `yaml:"host" validate:"required"`
+	Port     int    `yaml:"port" validate:"min=1,max=65535"`
+	Dbname   string `yaml:"dbname" validate:"required"`
+	Sslmode  string `yaml:"sslmode" validate:"oneof=disable require verify-ca verify-full"`
+	// StatementTimeout makes postgres cancel any statement running
+	// longer, so a slow query can't hold a connection indefinitely. 0
+	// disables it.
+	StatementTimeout time.Duration `yaml:"statement_timeout" validate:"gte=0"`
+	// AutoMigrate applies pending migrations on start, replicas starting
+	// together take turns through an advisory lock.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
 
-	// fallback to env vars if config file not available
-	config.Database.User = os.Getenv("DATABASE_USER")
-	config.Database.Password = os.Getenv("DATABASE_PASSWORD")
-	config.Database.Host = os.Getenv("DATABASE_HOST")
-	config.Database.Sslmode = os.Getenv("DATABASE_SSLMODE")
-	port, err := strconv.Atoi(os.Getenv("DATABASE_PORT"))
-	if err != nil {
-		log.Fatalf("error convert to int: %v", err)
-		return nil, err
+// DSN returns the connection string of the database.
+func (d DatabaseConfig) DSN() string {
+	query := url.Values{}
+	query.Set("sslmode", d.Sslmode)
+	// sent as a startup parameter, so it applies to every connection
+	query.Set("statement_timeout", strconv.FormatInt(d.StatementTimeout.Milliseconds(), 10))
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.User, d.Password),
+		Host:     net.JoinHostPort(d.Host, strconv.Itoa(d.Port)),
+		Path:     "/" + d.Dbname,
+		RawQuery: query.Encode(),
 	}
-	config.Database.Port = port
-	config.Database.Dbname = os.Getenv("DATABASE_NAME")
+	return dsn.String()
+}
+
+// ServerConfig configures the HTTP server.
+type ServerConfig struct {
+	// Host is the interface to listen on, all of them when empty.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port" validate:"min=1,max=65535"`
+	// ReadHeaderTimeout bounds reading request headers. Reading bodies and
+	// writing responses are unbounded by default as batch streams and
+	// cover uploads can take long.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" validate:"gte=0"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" validate:"gte=0"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" validate:"gte=0"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" validate:"gte=0"`
+	// RequestTimeout is the deadline of the work done for a request, batch
+	// requests excepted as they may stream for long, 0 disables it.
+	RequestTimeout time.Duration `yaml:"request_timeout" validate:"gte=0"`
+	// DrainDelay is how long readiness fails before the server stops
+	// accepting connections, long enough for load balancers to notice.
+	DrainDelay time.Duration `yaml:"drain_delay" validate:"gte=0"`
+	// ShutdownTimeout bounds the wait for in-flight requests, connections
+	// still open after it are closed.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" validate:"gt=0"`
+}
+
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// HealthConfig configures the readiness checks.
+type HealthConfig struct {
+	// Timeout bounds each check, a check running longer counts as down.
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// TracingConfig configures OpenTelemetry tracing.
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp" (OTLP over HTTP).
+	Exporter string `yaml:"exporter" validate:"oneof=none stdout otlp"`
+	// Endpoint is the host:port of the OTLP collector, the standard
+	// OTEL_EXPORTER_OTLP_* variables apply when it is empty.
+	Endpoint string `yaml:"endpoint"`
+	Insecure bool   `yaml:"insecure"`
+	// SampleRatio is the share of new traces recorded, 0 records none.
+	// Requests arriving with a sampled traceparent are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio" validate:"gte=0,lte=1"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// LogConfig configures application and access logs.
+type LogConfig struct {
+	// Format is "text" for humans or "json" for log collectors.
+	Format string `yaml:"format" validate:"oneof=text json"`
+	Level  string `yaml:"level" validate:"oneof=trace debug info warn warning error fatal panic"`
+}
+
+// RateLimitConfig configures per-client token buckets, clients are keyed by
+// API key, then user, then IP address.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Store is "memory" (per replica) or "redis" (shared).
+	Store string      `yaml:"store" validate:"oneof=memory redis"`
+	Redis RedisConfig `yaml:"redis"`
+	// TrustProxy takes the client IP from X-Forwarded-For, only enable it
+	// behind a proxy that sets the header.
+	TrustProxy bool `yaml:"trust_proxy"`
+	// Groups holds the limit of each route group: auth, read, write and urls,
+	// and ip which applies to every request before authentication.
+	Groups map[string]RateLimitRule `yaml:"groups"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password" secret:"true"`
+	DB       int    `yaml:"db" validate:"gte=0"`
+}
+
+// RateLimitRule allows Requests per Per, with bursts of up to Burst
+// requests (defaults to Requests).
+type RateLimitRule struct {
+	Requests int           `yaml:"requests" validate:"gt=0"`
+	Per      time.Duration `yaml:"per" validate:"gt=0"`
+	Burst    int           `yaml:"burst" validate:"gte=0"`
+}
+
+// AuthConfig configures staff authentication.
+type AuthConfig struct {
+	// JWTSecret signs access tokens (HS256), it is required.
+	JWTSecret       string        `yaml:"jwt_secret" secret:"true" validate:"required,min=32"`
+	Issuer          string        `yaml:"issuer"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" validate:"gt=0"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" validate:"gt=0"`
+}
+
+// LinksConfig configures the URL shortener.
+type LinksConfig struct {
+	// BaseURL is the public address short codes are served from.
+	BaseURL string `yaml:"base_url" validate:"omitempty,url"`
+}
+
+// MetadataConfig configures the external bibliographic source used to
+// pre-fill book details from an ISBN.
+type MetadataConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	BaseURL  string        `yaml:"base_url" validate:"required_if=Enabled true,omitempty,url"`
+	Timeout  time.Duration `yaml:"timeout" validate:"gt=0"`
+	CacheTTL time.Duration `yaml:"cache_ttl" validate:"gte=0"`
+}
 
-	if config.Database.User == "" || config.Database.Password == "" || config.Database.Host == "" || config.Database.Dbname == "" {
-		log.Fatalf("Missing required configuration for database connection from environment variables")
-		return nil, fmt.Errorf("missing required environment variables")
+// CoversConfig configures where uploaded cover images are stored.
+type CoversConfig struct {
+	// Storage is either "local" or "s3".
+	Storage       string           `yaml:"storage" validate:"oneof=local s3"`
+	LocalPath     string           `yaml:"local_path"`
+	MaxUploadSize int64            `yaml:"max_upload_size" validate:"gt=0"`
+	PublicBaseURL string           `yaml:"public_base_url" validate:"omitempty,url"`
+	S3            S3Config         `yaml:"s3"`
+	HealthCheck   CoverCheckConfig `yaml:"health_check"`
+}
+
+// CoverCheckConfig configures the background job verifying cover URLs.
+type CoverCheckConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Interval        time.Duration `yaml:"interval" validate:"gt=0"`
+	Timeout         time.Duration `yaml:"timeout" validate:"gt=0"`
+	Concurrency     int           `yaml:"concurrency" validate:"gt=0"`
+	PerHostInterval time.Duration `yaml:"per_host_interval" validate:"gte=0"`
+	Mirror          bool          `yaml:"mirror"`
+}
+
+type S3Config struct {
+	Endpoint  string        `yaml:"endpoint"`
+	Region    string        `yaml:"region"`
+	Bucket    string        `yaml:"bucket"`
+	AccessKey string        `yaml:"access_key" secret:"true"`
+	SecretKey string        `yaml:"secret_key" secret:"true"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// UrlsConfig configures the URL processing operations.
+type UrlsConfig struct {
+	Redirect RedirectConfig `yaml:"redirect"`
+	Tracking TrackingConfig `yaml:"tracking"`
+	Batch    BatchConfig    `yaml:"batch"`
+	Resolve  ResolveConfig  `yaml:"resolve"`
+	// Pipelines compose operations under a new name, steps run in order.
+	Pipelines map[string]PipelineConfig `yaml:"pipelines"`
+}
+
+type PipelineConfig struct {
+	Description string   `yaml:"description"`
+	Steps       []string `yaml:"steps"`
+}
+
+// ResolveConfig configures the resolve operation that follows live redirects.
+type ResolveConfig struct {
+	MaxHops         int           `yaml:"max_hops" validate:"gt=0"`
+	Timeout         time.Duration `yaml:"timeout" validate:"gt=0"`
+	FollowCanonical bool          `yaml:"follow_canonical"`
+	// AllowPrivate lets resolve reach loopback and private networks, keep it
+	// off outside of tests to prevent SSRF.
+	AllowPrivate bool `yaml:"allow_private"`
+}
+
+// BatchConfig limits the batch URL processing endpoint.
+type BatchConfig struct {
+	Workers int `yaml:"workers" validate:"gt=0"`
+	// MaxItems caps batches, larger JSON arrays are refused and NDJSON
+	// streams stop there.
+	MaxItems int `yaml:"max_items" validate:"gt=0"`
+	// Timeout bounds a whole batch, it replaces server.request_timeout on
+	// the batch route.
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+// TrackingConfig drives the strip-tracking operation, it is reloaded on SIGHUP.
+type TrackingConfig struct {
+	// DenyList holds parameter names to remove, a trailing "*" matches a prefix.
+	DenyList []string `yaml:"deny_list"`
+	// AllowList keeps the listed parameters for a host even when denied.
+	AllowList    map[string][]string `yaml:"allow_list"`
+	SortParams   bool                `yaml:"sort_params"`
+	DropFragment bool                `yaml:"drop_fragment"`
+}
+
+// RedirectConfig holds the rules applied by the redirection operation.
+type RedirectConfig struct {
+	// HostMappings maps a source host to its target. Keys may be an exact
+	// host, a "*.example.com" subdomain pattern or "*" for any host.
+	HostMappings map[string]string `yaml:"host_mappings"`
+	// Scheme, when set, is enforced on every URL ("http" or "https").
+	Scheme             string              `yaml:"scheme"`
+	PathPrefixRewrites []PathPrefixRewrite `yaml:"path_prefix_rewrites"`
+	RegexRewrites      []RegexRewrite      `yaml:"regex_rewrites"`
+	Lowercase          LowercaseComponents `yaml:"lowercase"`
+}
+
+type PathPrefixRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// RegexRewrite replaces path matches of Pattern, Replacement may refer to
+// capture groups as $1 or ${name}.
+type RegexRewrite struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"`
+}
+
+// LowercaseComponents selects the case-sensitive URL components to lowercase,
+// scheme and host are always lowercased.
+type LowercaseComponents struct {
+	Path     bool `yaml:"path"`
+	Query    bool `yaml:"query"`
+	Fragment bool `yaml:"fragment"`
+}
+
+// defaults returns the configuration the layers start from, a setting
+// they don't mention keeps its default while an explicit zero, such as a
+// statement_timeout of 0, is kept.
+func defaults() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Port: 5432,
+			// the lib/pq default
+			Sslmode:          "require",
+			StatementTimeout: 5 * time.Second,
+		},
+		Metadata: MetadataConfig{
+			BaseURL:  "https://openlibrary.org",
+			Timeout:  5 * time.Second,
+			CacheTTL: 24 * time.Hour,
+		},
+		Covers: CoversConfig{
+			Storage:       "local",
+			LocalPath:     "data/covers",
+			MaxUploadSize: 5 << 20,
+			S3:            S3Config{Timeout: 30 * time.Second},
+			HealthCheck: CoverCheckConfig{
+				Interval:        6 * time.Hour,
+				Timeout:         10 * time.Second,
+				Concurrency:     4,
+				PerHostInterval: 500 * time.Millisecond,
+			},
+		},
+		Urls: UrlsConfig{
+			Tracking: TrackingConfig{
+				DenyList: []string{
+					"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_eid", "mc_cid", "_ga", "_gl", "igshid", "yclid", "ref_src",
+				},
+			},
+			Batch:   BatchConfig{Workers: 8, MaxItems: 10000, Timeout: 5 * time.Minute},
+			Resolve: ResolveConfig{MaxHops: 10, Timeout: 10 * time.Second},
+		},
+		Links: LinksConfig{BaseURL: "http://localhost:9000"},
+		Auth: AuthConfig{
+			Issuer:          "mini-books-library",
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "mini-books-library",
+		},
+		Server: ServerConfig{
+			Port:              9000,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			RequestTimeout:    30 * time.Second,
+			ShutdownTimeout:   15 * time.Second,
+		},
+		Health: HealthConfig{Timeout: 2 * time.Second},
+		CORS: CORSConfig{
+			CORSPolicy: CORSPolicy{
+				AllowMethods:  []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+				AllowHeaders:  []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "Traceparent"},
+				ExposeHeaders: []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Location"},
+				MaxAge:        10 * time.Minute,
+			},
+		},
+		Log: LogConfig{Format: "text", Level: "info"},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+		},
 	}
+}
 
-	return config, nil
+// setDefaults fills in the sections that only get defaults when left out
+// entirely once every layer is applied.
+func (c *Config) setDefaults() {
+	defaultGroups := map[string]RateLimitRule{
+		"ip":    {Requests: 600, Per: time.Minute},
+		"auth":  {Requests: 10, Per: time.Minute, Burst: 5},
+		"read":  {Requests: 300, Per: time.Minute},
+		"write": {Requests: 60, Per: time.Minute},
+		"urls":  {Requests: 120, Per: time.Minute},
+	}
+	if c.RateLimit.Groups == nil {
+		c.RateLimit.Groups = make(map[string]RateLimitRule)
+	}
+	for group, rule := range defaultGroups {
+		if _, ok := c.RateLimit.Groups[group]; !ok {
+			c.RateLimit.Groups[group] = rule
+		}
+	}
+	if len(c.Urls.Pipelines) == 0 {
+		c.Urls.Pipelines = map[string]PipelineConfig{
+			"all": {Description: "Canonical cleanup followed by redirection", Steps: []string{"canonical", "redirection"}},
+		}
+	}
+	// without any redirect rules keep the historical behaviour of sending
+	// everything to www.byfood.com fully lowercased
+	if len(c.Urls.Redirect.HostMappings) == 0 && c.Urls.Redirect.Scheme == "" &&
+		len(c.Urls.Redirect.PathPrefixRewrites) == 0 && len(c.Urls.Redirect.RegexRewrites) == 0 {
+		c.Urls.Redirect.HostMappings = map[string]string{"*": "www.byfood.com"}
+		c.Urls.Redirect.Lowercase = LowercaseComponents{Path: true, Query: true, Fragment: true}
+	}
 }
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "REDACTED"
+
+// Redacted returns the configuration as YAML with the secret settings
+// masked, durations are written the way they are configured ("5s").
+func (c *Config) Redacted() ([]byte, error) {
+	return yaml.Marshal(redact(reflect.ValueOf(*c)))
+}
+
+func redact(v reflect.Value) interface{} {
+	if v.Type() == durationType {
+		return v.Interface().(time.Duration).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var out yaml.MapSlice
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if isInline(t.Field(i)) {
+				out = append(out, redact(v.Field(i)).(yaml.MapSlice)...)
+				continue
+			}
+
+			name := yamlName(t.Field(i))
+			if name == "" {
+				continue
+			}
+
+			field := v.Field(i)
+			if t.Field(i).Tag.Get("secret") == "true" && !field.IsZero() {
+				out = append(out, yaml.MapItem{Key: name, Value: redacted})
+				continue
+			}
+			out = append(out, yaml.MapItem{Key: name, Value: redact(field)})
+		}
+		return out
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+		var out yaml.MapSlice
+		for _, key := range keys {
+			out = append(out, yaml.MapItem{Key: key.Interface(), Value: redact(v.MapIndex(key))})
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redact(v.Index(i))
+		}
+		return out
+	}
+
+	return v.Interface()
+}
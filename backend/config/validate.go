@@ -0,0 +1,100 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ValidationError lists every problem of a configuration, each naming the
+// setting by its YAML path.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the settings against their validate tags and the rules
+// spanning several settings.
+func (c *Config) Validate() error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(yamlName)
+
+	var problems []string
+	var verrs validator.ValidationErrors
+	if err := validate.Struct(c); errors.As(err, &verrs) {
+		for _, verr := range verrs {
+			// the namespace starts with the type name, Config.server.port
+			_, path, _ := strings.Cut(verr.Namespace(), ".")
+			problems = append(problems, path+" "+describe(verr))
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if c.Covers.Storage == "s3" && c.Covers.S3.Bucket == "" {
+		problems = append(problems, "covers.s3.bucket is required with covers.storage s3")
+	}
+	if c.RateLimit.Enabled && c.RateLimit.Store == "redis" && c.RateLimit.Redis.Addr == "" {
+		problems = append(problems, "rate_limit.redis.addr is required with rate_limit.store redis")
+	}
+
+	if c.CORS.AllowCredentials && containsString(c.CORS.AllowOrigins, "*") {
+		problems = append(problems, `cors.allow_credentials can't be used with "*" in cors.allow_origins`)
+	}
+	for prefix, route := range c.CORS.Routes {
+		origins := route.AllowOrigins
+		if origins == nil {
+			origins = c.CORS.AllowOrigins
+		}
+		if route.AllowCredentials && containsString(origins, "*") {
+			problems = append(problems, fmt.Sprintf(`cors.routes.%s.allow_credentials can't be used with "*" as origin`, prefix))
+		}
+	}
+
+	if len(problems) > 0 {
+		return ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func describe(verr validator.FieldError) string {
+	param := verr.Param()
+	switch verr.Tag() {
+	case "required", "required_if":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "url":
+		return "must be a URL"
+	case "min":
+		if verr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", param)
+		}
+		return "must be at least " + param
+	case "max":
+		return "must be at most " + param
+	case "gt":
+		return "must be greater than " + param
+	case "gte":
+		return "must be at least " + param
+	case "lte":
+		return "must be at most " + param
+	}
+
+	return fmt.Sprintf("failed the %s rule", verr.Tag())
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goesbams/mini-books-library/backend/health"
+	"github.com/jmoiron/sqlx"
+)
+
+// PingCheck checks the database answers.
+func PingCheck(db *sqlx.DB) health.Checker {
+	return health.CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// MigrationCheck checks the schema is at the latest migration, so traffic
+// never reaches an instance whose queries expect missing columns.
+func MigrationCheck(db *sqlx.DB, migrator *Migrator) health.Checker {
+	expected := migrator.Latest()
+
+	return health.CheckerFunc(func(ctx context.Context) error {
+		version, dirty, err := MigrationVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d failed halfway", version)
+		}
+		if version != expected {
+			return fmt.Errorf("schema at version %d, expected %d", version, expected)
+		}
+		return nil
+	})
+}
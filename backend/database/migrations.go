@@ -0,0 +1,511 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// migrationLockID is the advisory lock serialising migration runs, so two
+// replicas starting together don't migrate at the same time.
+const migrationLockID = 7_352_601_884
+
+var (
+	migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	migrationName = regexp.MustCompile(`^\w+$`)
+)
+
+// schema_migrations keeps the layout of golang-migrate, so databases it
+// migrated carry on where it left off. Checksums live in a table of their
+// own.
+const migrationTables = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		dirty BOOLEAN NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS schema_migration_checksums (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)
+`
+
+// Migration is a pair of NNNN_name.up.sql and NNNN_name.down.sql files.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the SHA-256 of the up file, it catches applied files
+	// edited afterwards.
+	Checksum string
+}
+
+// MigrationStatus is a migration as seen by the database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+	// Drifted means the file changed since it was applied.
+	Drifted bool
+	// Untracked means it was applied before checksums were recorded.
+	Untracked bool
+}
+
+// Migrator applies the migrations of a file system to the database.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator reads the migrations of files, which holds them at its root.
+func NewMigrator(db *sqlx.DB, files fs.FS) (*Migrator, error) {
+	migrations, err := readMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest returns the version a fully migrated schema is at.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies the next n pending migrations, all of them when n is 0.
+func (m *Migrator) Up(ctx context.Context, n int) error {
+	return m.migrate(ctx, func(current uint) (uint, error) {
+		target := current
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			target = migration.Version
+			if n--; n == 0 {
+				break
+			}
+		}
+		return target, nil
+	})
+}
+
+// Down reverts the last n applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.migrate(ctx, func(current uint) (uint, error) {
+		index := m.index(current) - n
+		if index < 0 {
+			return 0, nil
+		}
+		return m.migrations[index].Version, nil
+	})
+}
+
+// Goto migrates up or down to version, 0 reverts every migration.
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.migrate(ctx, func(uint) (uint, error) {
+		return version, nil
+	})
+}
+
+// Status lists every migration with its state in the database, along with
+// the schema version. It only reads, a database never migrated has no
+// migration tables and reports nothing applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, uint, bool, error) {
+	var tables struct {
+		Versions  bool `db:"versions"`
+		Checksums bool `db:"checksums"`
+	}
+	err := m.db.GetContext(ctx, &tables, `
+		SELECT to_regclass('schema_migrations') IS NOT NULL AS versions,
+			to_regclass('schema_migration_checksums') IS NOT NULL AS checksums
+	`)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("look up migration tables: %w", err)
+	}
+
+	var version uint
+	var dirty bool
+	if tables.Versions {
+		if version, dirty, err = MigrationVersion(ctx, m.db); err != nil {
+			return nil, 0, false, err
+		}
+	}
+	// golang-migrate created only schema_migrations, checksums come later
+	recorded := map[uint]checksumRecord{}
+	if tables.Checksums {
+		if recorded, err = recordedChecksums(ctx, m.db); err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration, Applied: migration.Version <= version}
+		if record, ok := recorded[migration.Version]; ok && status.Applied {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.Drifted = record.Checksum != migration.Checksum
+		} else if status.Applied {
+			status.Untracked = true
+		}
+		statuses[i] = status
+	}
+
+	return statuses, version, dirty, nil
+}
+
+// migrate moves the schema to the version target picks from the current
+// one, holding the advisory lock on a single connection throughout.
+func (m *Migrator) migrate(ctx context.Context, target func(current uint) (uint, error)) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// migrations and waiting for the lock may take longer than queries
+	if _, err := conn.ExecContext(ctx, `SET statement_timeout = 0`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `RESET statement_timeout`)
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.ExecContext(ctx, migrationTables); err != nil {
+		return fmt.Errorf("create migration tables: %w", err)
+	}
+
+	current, err := m.current(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(ctx, conn, current); err != nil {
+		return err
+	}
+
+	to, err := target(current)
+	if err != nil {
+		return err
+	}
+	if to == current {
+		logrus.Infof("schema is at version %d, nothing to migrate", current)
+		return nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > current && migration.Version <= to {
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= current && migration.Version > to {
+			if err := m.revert(ctx, conn, migration, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) current(ctx context.Context, conn *sqlx.Conn) (uint, error) {
+	version, dirty, err := MigrationVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("schema is dirty at version %d, a migration failed halfway and needs fixing by hand", version)
+	}
+	if version != 0 && m.index(version) < 0 {
+		return 0, fmt.Errorf("schema is at version %d which has no migration file", version)
+	}
+
+	return version, nil
+}
+
+// verify checks the applied migrations still match their files. Those
+// applied before checksums were tracked get theirs recorded.
+func (m *Migrator) verify(ctx context.Context, conn *sqlx.Conn, current uint) error {
+	recorded, err := recordedChecksums(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			break
+		}
+
+		record, ok := recorded[migration.Version]
+		if !ok {
+			if err := recordChecksum(ctx, conn, migration); err != nil {
+				return err
+			}
+			logrus.Infof("recorded checksum of migration %s applied before checksums were tracked", migration.file())
+			continue
+		}
+		if record.Checksum != migration.Checksum {
+			return fmt.Errorf("migration %s changed after it was applied, restore it and add a new migration instead", migration.file())
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, migration Migration) error {
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if err := execScript(ctx, tx, migration.Up); err != nil {
+			return err
+		}
+		if err := setVersion(ctx, tx, migration.Version); err != nil {
+			return err
+		}
+		return recordChecksum(ctx, tx, migration)
+	})
+	if err != nil {
+		return fmt.Errorf("apply migration %s: %w", migration.file(), err)
+	}
+
+	logrus.Infof("applied migration %s", migration.file())
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sqlx.Conn, migration Migration, index int) error {
+	var previous uint
+	if index > 0 {
+		previous = m.migrations[index-1].Version
+	}
+
+	err := inTx(ctx, conn, func(tx *sql.Tx) error {
+		if err := execScript(ctx, tx, migration.Down); err != nil {
+			return err
+		}
+		if err := setVersion(ctx, tx, previous); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM schema_migration_checksums WHERE version = $1`, migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("revert migration %s: %w", migration.file(), err)
+	}
+
+	logrus.Infof("reverted migration %s", migration.file())
+	return nil
+}
+
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m Migration) file() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// inTx runs fn in a transaction, each migration applies entirely or not
+// at all.
+func inTx(ctx context.Context, conn *sqlx.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func execScript(ctx context.Context, tx *sql.Tx, script string) error {
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, script)
+	return err
+}
+
+func setVersion(ctx context.Context, tx *sql.Tx, version uint) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
+
+type checksumRecord struct {
+	Version   uint      `db:"version"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+func recordedChecksums(ctx context.Context, db sqlx.QueryerContext) (map[uint]checksumRecord, error) {
+	var records []checksumRecord
+	if err := sqlx.SelectContext(ctx, db, &records, `SELECT version, checksum, applied_at FROM schema_migration_checksums`); err != nil {
+		return nil, fmt.Errorf("read migration checksums: %w", err)
+	}
+
+	byVersion := make(map[uint]checksumRecord, len(records))
+	for _, record := range records {
+		byVersion[record.Version] = record
+	}
+
+	return byVersion, nil
+}
+
+func recordChecksum(ctx context.Context, db sqlx.ExecerContext, migration Migration) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO schema_migration_checksums (version, name, checksum)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (version) DO UPDATE SET name = EXCLUDED.name, checksum = EXCLUDED.checksum
+	`, migration.Version, migration.Name, migration.Checksum)
+	return err
+}
+
+// readMigrations pairs the up and down files of files by version.
+func readMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*Migration)
+	// a freshly created migration has empty files, so presence is tracked
+	// apart from the content
+	hasUp, hasDown := make(map[uint]bool), make(map[uint]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			migration.Up = string(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+			hasUp[migration.Version] = true
+		} else {
+			migration.Down = string(content)
+			hasDown[migration.Version] = true
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if !hasUp[migration.Version] || !hasDown[migration.Version] {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration.file())
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// CreateMigration writes empty up and down files for the next version in
+// dir and returns their paths.
+func CreateMigration(dir, name string) (string, string, error) {
+	if !migrationName.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q, use letters, digits and underscores", name)
+	}
+
+	existing, err := readMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var next uint = 1
+	if len(existing) > 0 {
+		next = existing[len(existing)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", next, name))
+	up, down := base+".up.sql", base+".down.sql"
+	for _, path := range []string{up, down} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
+
+// MigrationVersion returns the schema version and whether the last
+// migration failed halfway, version 0 means nothing was applied yet.
+func MigrationVersion(ctx context.Context, db sqlx.QueryerContext) (uint, bool, error) {
+	var state struct {
+		Version uint `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+
+	err := sqlx.GetContext(ctx, db, &state, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return state.Version, state.Dirty, nil
+}
@@ -0,0 +1,402 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeSchema is the database seen by the migrator. It answers the
+// bookkeeping statements of migrations.go and records every other one as a
+// migration script, a script containing FAIL fails.
+type fakeSchema struct {
+	tables    bool
+	versions  bool
+	version   int64
+	dirty     bool
+	checksums map[int64]string
+	scripts   []string
+	created   int
+}
+
+func (s *fakeSchema) clone() *fakeSchema {
+	c := *s
+	c.checksums = make(map[int64]string, len(s.checksums))
+	for version, sum := range s.checksums {
+		c.checksums[version] = sum
+	}
+	c.scripts = append([]string(nil), s.scripts...)
+	return &c
+}
+
+func (s *fakeSchema) exec(query string, args []driver.NamedValue) error {
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "SET "), strings.HasPrefix(query, "RESET "), strings.HasPrefix(query, "SELECT pg_advisory_"):
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		s.tables, s.versions = true, true
+		s.created++
+	case query == "DELETE FROM schema_migrations":
+		s.version = 0
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations "):
+		s.version = args[0].Value.(int64)
+	case strings.HasPrefix(query, "INSERT INTO schema_migration_checksums "):
+		s.checksums[args[0].Value.(int64)] = args[2].Value.(string)
+	case strings.HasPrefix(query, "DELETE FROM schema_migration_checksums "):
+		delete(s.checksums, args[0].Value.(int64))
+	default:
+		if strings.Contains(query, "FAIL") {
+			return errors.New("syntax error")
+		}
+		s.scripts = append(s.scripts, query)
+	}
+	return nil
+}
+
+func (s *fakeSchema) query(query string) (driver.Rows, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	switch {
+	case strings.HasPrefix(query, "SELECT to_regclass"):
+		return &fakeRows{columns: []string{"versions", "checksums"}, values: [][]driver.Value{{s.versions, s.tables}}}, nil
+	case strings.HasPrefix(query, "SELECT version, dirty FROM schema_migrations"):
+		if !s.versions {
+			return nil, errors.New(`relation "schema_migrations" does not exist`)
+		}
+		rows := &fakeRows{columns: []string{"version", "dirty"}}
+		if s.version != 0 {
+			rows.values = [][]driver.Value{{s.version, s.dirty}}
+		}
+		return rows, nil
+	case strings.HasPrefix(query, "SELECT version, checksum, applied_at FROM schema_migration_checksums"):
+		if !s.tables {
+			return nil, errors.New(`relation "schema_migration_checksums" does not exist`)
+		}
+		rows := &fakeRows{columns: []string{"version", "checksum", "applied_at"}}
+		for version, sum := range s.checksums {
+			rows.values = append(rows.values, []driver.Value{version, sum, time.Now()})
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query " + query)
+}
+
+type fakeConnector struct {
+	schema *fakeSchema
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{c.schema}, nil
+}
+func (c *fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	schema *fakeSchema
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{conn: c, saved: c.schema.clone()}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), c.schema.exec(query, args)
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.schema.query(query)
+}
+
+// fakeTx restores the schema on rollback, as Postgres does for DDL.
+type fakeTx struct {
+	conn  *fakeConn
+	saved *fakeSchema
+}
+
+func (tx *fakeTx) Commit() error { return nil }
+
+func (tx *fakeTx) Rollback() error {
+	*tx.conn.schema = *tx.saved
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var testMigrations = fstest.MapFS{
+	"0001_books.up.sql":    {Data: []byte("up 1")},
+	"0001_books.down.sql":  {Data: []byte("down 1")},
+	"0002_users.up.sql":    {Data: []byte("up 2")},
+	"0002_users.down.sql":  {Data: []byte("down 2")},
+	"0010_links.up.sql":    {Data: []byte("up 10")},
+	"0010_links.down.sql":  {Data: []byte("down 10")},
+	"README.md":            {Data: []byte("not a migration")},
+	"seeds/0001_x.up.sql":  {Data: []byte("ignored, not at the root")},
+	"0011_empty.up.sql":    {},
+	"0011_empty.down.sql":  {},
+	"0012_broken.up.sql":   {Data: []byte("FAIL")},
+	"0012_broken.down.sql": {Data: []byte("down 12")},
+}
+
+// newTestMigrator returns a migrator over files and a schema already at
+// version, with the checksums of the migrations up to it recorded.
+func newTestMigrator(t *testing.T, files fstest.MapFS, version int64) (*Migrator, *fakeSchema) {
+	t.Helper()
+
+	schema := &fakeSchema{checksums: make(map[int64]string)}
+	db := sqlx.NewDb(sql.OpenDB(&fakeConnector{schema}), "postgres")
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := NewMigrator(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version > 0 {
+		schema.tables, schema.versions, schema.version = true, true, version
+		for _, migration := range migrator.migrations {
+			if int64(migration.Version) <= version {
+				schema.checksums[int64(migration.Version)] = migration.Checksum
+			}
+		}
+	}
+	return migrator, schema
+}
+
+func TestMigratorTargets(t *testing.T) {
+	files := fstest.MapFS{}
+	for name, file := range testMigrations {
+		if !strings.HasPrefix(name, "0012") {
+			files[name] = file
+		}
+	}
+
+	tests := []struct {
+		name        string
+		from        int64
+		migrate     func(*Migrator) error
+		wantVersion int64
+		wantScripts []string
+	}{
+		{name: "up all", migrate: func(m *Migrator) error { return m.Up(context.Background(), 0) }, wantVersion: 11, wantScripts: []string{"up 1", "up 2", "up 10"}},
+		{name: "up one", migrate: func(m *Migrator) error { return m.Up(context.Background(), 1) }, wantVersion: 1, wantScripts: []string{"up 1"}},
+		{name: "up two from the middle", from: 1, migrate: func(m *Migrator) error { return m.Up(context.Background(), 2) }, wantVersion: 10, wantScripts: []string{"up 2", "up 10"}},
+		{name: "up when current", from: 11, migrate: func(m *Migrator) error { return m.Up(context.Background(), 0) }, wantVersion: 11},
+		{name: "down one", from: 10, migrate: func(m *Migrator) error { return m.Down(context.Background(), 1) }, wantVersion: 2, wantScripts: []string{"down 10"}},
+		{name: "down past the first", from: 2, migrate: func(m *Migrator) error { return m.Down(context.Background(), 5) }, wantVersion: 0, wantScripts: []string{"down 2", "down 1"}},
+		{name: "goto forward", from: 1, migrate: func(m *Migrator) error { return m.Goto(context.Background(), 10) }, wantVersion: 10, wantScripts: []string{"up 2", "up 10"}},
+		{name: "goto back", from: 11, migrate: func(m *Migrator) error { return m.Goto(context.Background(), 2) }, wantVersion: 2, wantScripts: []string{"down 10"}},
+		{name: "goto zero", from: 2, migrate: func(m *Migrator) error { return m.Goto(context.Background(), 0) }, wantVersion: 0, wantScripts: []string{"down 2", "down 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, schema := newTestMigrator(t, files, tt.from)
+
+			if err := tt.migrate(migrator); err != nil {
+				t.Fatalf("migrate failed: %v", err)
+			}
+			if schema.version != tt.wantVersion {
+				t.Errorf("version %d, want %d", schema.version, tt.wantVersion)
+			}
+			if !reflect.DeepEqual(schema.scripts, tt.wantScripts) {
+				t.Errorf("ran %q, want %q", schema.scripts, tt.wantScripts)
+			}
+			for _, migration := range migrator.migrations {
+				_, recorded := schema.checksums[int64(migration.Version)]
+				if applied := int64(migration.Version) <= schema.version; recorded != applied {
+					t.Errorf("checksum of %s recorded %v, applied %v", migration.file(), recorded, applied)
+				}
+			}
+		})
+	}
+
+	migrator, _ := newTestMigrator(t, files, 0)
+	if err := migrator.Goto(context.Background(), 3); err == nil {
+		t.Error("Goto accepted a version without a migration")
+	}
+}
+
+func TestMigratorRefuses(t *testing.T) {
+	t.Run("dirty schema", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 2)
+		schema.dirty = true
+
+		if err := migrator.Up(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "dirty") {
+			t.Fatalf("err = %v, want a dirty schema error", err)
+		}
+		if len(schema.scripts) != 0 {
+			t.Errorf("ran %q on a dirty schema", schema.scripts)
+		}
+	})
+
+	t.Run("version without a file", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 2)
+		schema.version = 3
+
+		if err := migrator.Up(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "no migration file") {
+			t.Fatalf("err = %v, want a missing file error", err)
+		}
+	})
+
+	t.Run("edited migration", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 2)
+		schema.checksums[1] = "checksum of an older 0001_books.up.sql"
+
+		if err := migrator.Up(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "0001_books changed") {
+			t.Fatalf("err = %v, want a drift error", err)
+		}
+		if len(schema.scripts) != 0 || schema.version != 2 {
+			t.Errorf("migrated to %d running %q despite the drift", schema.version, schema.scripts)
+		}
+	})
+
+	t.Run("failing migration", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 10)
+
+		err := migrator.Up(context.Background(), 0)
+		if err == nil || !strings.Contains(err.Error(), "apply migration 0012_broken") {
+			t.Fatalf("err = %v, want the broken migration", err)
+		}
+		// 0011 applied, 0012 rolled back with its version
+		if schema.version != 11 || schema.checksums[12] != "" {
+			t.Errorf("version %d, checksums %v after the failure", schema.version, schema.checksums)
+		}
+	})
+}
+
+func TestMigratorRecordsUntrackedChecksums(t *testing.T) {
+	migrator, schema := newTestMigrator(t, testMigrations, 2)
+	// applied by golang-migrate, before checksums were tracked
+	delete(schema.checksums, 1)
+	delete(schema.checksums, 2)
+
+	if err := migrator.Up(context.Background(), 1); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	for _, version := range []int64{1, 2, 10} {
+		if schema.checksums[version] != migrator.migrations[migrator.index(uint(version))].Checksum {
+			t.Errorf("checksum of version %d = %q", version, schema.checksums[version])
+		}
+	}
+}
+
+func TestMigratorStatus(t *testing.T) {
+	t.Run("never migrated", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 0)
+
+		statuses, version, dirty, err := migrator.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if schema.created != 0 {
+			t.Error("Status created the migration tables")
+		}
+		if version != 0 || dirty || len(statuses) != 5 {
+			t.Fatalf("version %d, dirty %v, %d statuses", version, dirty, len(statuses))
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				t.Errorf("%s reported applied", status.file())
+			}
+		}
+	})
+
+	t.Run("migrated by golang-migrate", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 0)
+		schema.versions, schema.version = true, 2
+
+		statuses, version, _, err := migrator.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if version != 2 || !statuses[1].Applied || !statuses[1].Untracked || statuses[2].Applied {
+			t.Errorf("version %d, statuses %+v", version, statuses)
+		}
+	})
+
+	t.Run("drifted", func(t *testing.T) {
+		migrator, schema := newTestMigrator(t, testMigrations, 10)
+		schema.dirty = true
+		schema.checksums[2] = "checksum of an older 0002_users.up.sql"
+
+		statuses, version, dirty, err := migrator.Status(context.Background())
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		if version != 10 || !dirty {
+			t.Errorf("version %d, dirty %v", version, dirty)
+		}
+		for _, status := range statuses {
+			wantDrifted := status.Version == 2
+			if status.Drifted != wantDrifted || status.Untracked || (status.AppliedAt != nil) != status.Applied {
+				t.Errorf("status %+v", status)
+			}
+		}
+	})
+}
+
+func TestReadMigrations(t *testing.T) {
+	migrations, err := readMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("readMigrations failed: %v", err)
+	}
+
+	var versions []uint
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 10, 11, 12}) {
+		t.Errorf("versions %v, want them sorted numerically", versions)
+	}
+	if migrations[0].Name != "books" || migrations[0].Up != "up 1" || migrations[0].Down != "down 1" {
+		t.Errorf("first migration %+v", migrations[0])
+	}
+	// sha256 of "up 1"
+	if migrations[0].Checksum != "19483c37486de6847387c1c3b35466a2fd655b971db79acea23a3ff2ccedfa44" {
+		t.Errorf("checksum %s", migrations[0].Checksum)
+	}
+	if migrations[3].Up != "" || migrations[3].Checksum == "" {
+		t.Errorf("empty migration %+v", migrations[3])
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing down": {"0001_books.up.sql": {}},
+		"missing up":   {"0001_books.down.sql": {}},
+		"shared version": {
+			"0001_books.up.sql": {}, "0001_books.down.sql": {},
+			"0001_users.up.sql": {}, "0001_users.down.sql": {},
+		},
+		"version zero":  {"0000_books.up.sql": {}, "0000_books.down.sql": {}},
+		"bad file name": {"0001-books.up.sql": {}},
+		"bad direction": {"0001_books.sideways.sql": {}},
+	}
+	for name, files := range invalid {
+		if _, err := readMigrations(files); err == nil {
+			t.Errorf("%s: readMigrations accepted %v", name, reflect.ValueOf(files).MapKeys())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+)
+
+type ApiKey struct {
+	ID         int            `json:"id" db:"id"`
+	Name       string         `json:"name" db:"name"`
+	Prefix     string         `json:"prefix" db:"prefix"`
+	KeyHash    string         `json:"-" db:"key_hash"`
+	Scopes     pq.StringArray `json:"scopes" db:"scopes" swaggertype:"array,string"`
+	CreatedBy  *int           `json:"created_by,omitempty" db:"created_by"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time     `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	// Key is the plaintext key, only returned once when the key is created.
+	Key string `json:"key,omitempty" db:"-"`
+}
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" form:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" form:"scopes" validate:"required,min=1,dive,oneof=urls:process books:write books:delete"`
+	ExpiresAt *time.Time `json:"expires_at" form:"expires_at"`
+}
+
+func (r *CreateApiKeyRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
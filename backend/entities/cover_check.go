@@ -0,0 +1,14 @@
+package entities
+
+import "time"
+
+type CoverCheck struct {
+	BookID        int        `json:"book_id" db:"book_id"`
+	Title         string     `json:"title,omitempty" db:"title"`
+	CoverImageUrl string     `json:"cover_image_url" db:"cover_image_url"`
+	StatusCode    int        `json:"status_code" db:"status_code"`
+	Healthy       bool       `json:"healthy" db:"healthy"`
+	Error         string     `json:"error,omitempty" db:"error"`
+	CheckedAt     time.Time  `json:"checked_at" db:"checked_at"`
+	MirroredAt    *time.Time `json:"mirrored_at,omitempty" db:"mirrored_at"`
+}
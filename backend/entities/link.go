@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type ShortLink struct {
+	ID        int        `json:"id" db:"id"`
+	Code      string     `json:"code" db:"code"`
+	TargetUrl string     `json:"target_url" db:"target_url"`
+	ShortUrl  string     `json:"short_url,omitempty" db:"-"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+type CreateShortLinkRequest struct {
+	TargetUrl string     `json:"target_url" form:"target_url" validate:"required,http_url,max=2048"`
+	Slug      string     `json:"slug" form:"slug" validate:"omitempty,min=3,max=32"`
+	ExpiresAt *time.Time `json:"expires_at" form:"expires_at"`
+}
+
+func (r *CreateShortLinkRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type LinkClickStat struct {
+	Day             string `json:"day" db:"day"`
+	ReferrerHost    string `json:"referrer_host" db:"referrer_host"`
+	UserAgentFamily string `json:"user_agent_family" db:"user_agent_family"`
+	Clicks          int    `json:"clicks" db:"clicks"`
+}
+
+type ShortLinkStats struct {
+	Code        string          `json:"code"`
+	TotalClicks int             `json:"total_clicks"`
+	Clicks      []LinkClickStat `json:"clicks"`
+}
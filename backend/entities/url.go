@@ -2,9 +2,84 @@ package entities
 
 type URLRequest struct {
 	URL       string `json:"url" validate:"required,url"`
-	Operation string `json:"operation" validate:"required,oneof=canonical redirection all"`
+	Operation string `json:"operation" validate:"required,url_operation"`
+	// Explain returns every intermediate URL and what each step changed
+	Explain bool `json:"explain,omitempty"`
 }
 
 type URLResponse struct {
-	ProcessedURL string `json:"processed_url"`
+	ProcessedURL string           `json:"processed_url"`
+	Hops         []URLHop         `json:"hops,omitempty"`
+	Steps        []URLExplainStep `json:"steps,omitempty"`
+}
+
+const (
+	HopViaRedirect  = "redirect"
+	HopViaCanonical = "canonical"
+)
+
+// URLHop is one step of a resolved chain, Via tells how the next hop was
+// reached and is empty on the final destination.
+type URLHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Via        string `json:"via,omitempty"`
+}
+
+type URLResolution struct {
+	FinalURL string
+	Hops     []URLHop
+}
+
+// URLComponentChange is one component modified by a step. Component is
+// scheme, host, path, query, fragment or query:<key> for a single parameter,
+// Rule names the configuration or behaviour responsible.
+type URLComponentChange struct {
+	Component string `json:"component"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	Rule      string `json:"rule"`
+}
+
+// URLExplainStep is the URL before and after one operation of a pipeline.
+type URLExplainStep struct {
+	Operation string               `json:"operation"`
+	Input     string               `json:"input"`
+	Output    string               `json:"output"`
+	Changes   []URLComponentChange `json:"changes"`
+}
+
+type URLExplanation struct {
+	FinalURL string
+	Steps    []URLExplainStep
+}
+
+// URLBatchResult is the outcome of one item of a batch, items keep the
+// position they had in the request.
+type URLBatchResult struct {
+	Index        int    `json:"index"`
+	URL          string `json:"url"`
+	Operation    string `json:"operation"`
+	ProcessedURL string `json:"processed_url,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// URLBatchStreamError is the last line of an NDJSON stream that stopped
+// before the end of its input, Processed counts the results sent before it.
+type URLBatchStreamError struct {
+	Error     string `json:"error"`
+	Processed int    `json:"processed"`
+}
+
+type URLBatchResponse struct {
+	Results   []URLBatchResult `json:"results"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// URLOperationInfo describes an operation, Steps lists the operations of a pipeline.
+type URLOperationInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Steps       []string `json:"steps,omitempty"`
 }
@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type User struct {
+	ID           int       `json:"id" db:"id"`
+	Email        string    `json:"email" db:"email"`
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         string    `json:"role" db:"role"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateUserRequest struct {
+	Email    string `json:"email" form:"email" validate:"required,email,max=255"`
+	Password string `json:"password" form:"password" validate:"required,min=12,max=72"`
+	Role     string `json:"role" form:"role" validate:"required,oneof=viewer librarian admin"`
+}
+
+func (r *CreateUserRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" form:"role" validate:"required,oneof=viewer librarian admin"`
+}
+
+func (r *UpdateUserRoleRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type RefreshToken struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	Family    string     `db:"family"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" form:"email" validate:"required,email"`
+	Password string `json:"password" form:"password" validate:"required"`
+}
+
+func (r *LoginRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token" validate:"required"`
+}
+
+func (r *RefreshRequest) Validate() error {
+	validate := validator.New()
+	return validate.Struct(r)
+}
+
+// LogoutRequest optionally carries the refresh token to revoke along with
+// the access token of the request.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+}
@@ -2,7 +2,7 @@
 
 # Run migrations
 echo "Running migrations..."
-migrate -path /app/backend/migrations -database postgres://$DATABASE_USER:$DATABASE_PASSWORD@$DATABASE_HOST:$DATABASE_PORT/$DATABASE_NAME?sslmode=$DATABASE_SSLMODE up
+/usr/local/bin/backend migrate up || exit 1
 
 # Start the backend
 echo "Starting backend..."
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type ApiKeyHandler struct {
+	service services.ApiKeyServiceInterface
+}
+
+func NewApiKeyHandler(service services.ApiKeyServiceInterface) *ApiKeyHandler {
+	return &ApiKeyHandler{service: service}
+}
+
+// CreateApiKey issues an API key
+// @Summary Create an API key
+// @Description Issue an API key for an integration with a set of scopes (urls:process, books:write, books:delete) and an optional expiry. The key is only returned in this response. Requires api-keys:manage
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body entities.CreateApiKeyRequest true "Name, scopes and optional expiry"
+// @Success 201 {object} entities.ApiKey
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /api-keys [post]
+func (h *ApiKeyHandler) CreateApiKey(c echo.Context) error {
+	var req entities.CreateApiKeyRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind api key request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	principal, _ := auth.PrincipalFromContext(c.Request().Context())
+
+	key, err := h.service.CreateApiKey(c.Request().Context(), principal, &req)
+	if err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		if errors.Is(err, auth.ErrForbidden) {
+			return apperrors.Forbidden(err.Error())
+		}
+
+		return apperrors.Internal(err, "unable to create api key")
+	}
+
+	requestLogger(c).WithFields(logrus.Fields{"key": key.Prefix, "scopes": key.Scopes}).Info("created api key")
+	return c.JSON(http.StatusCreated, key)
+}
+
+// GetApiKeys lists API keys
+// @Summary Get all API keys
+// @Description List API keys with their prefix, scopes, expiry and last use, never the keys themselves. Requires api-keys:manage
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} entities.ApiKey
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /api-keys [get]
+func (h *ApiKeyHandler) GetApiKeys(c echo.Context) error {
+	keys, err := h.service.GetApiKeys(c.Request().Context())
+	if err != nil {
+		return apperrors.Internal(err, "unable to fetch api keys")
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeApiKey revokes an API key
+// @Summary Revoke an API key
+// @Description Revoke an API key immediately. Requires api-keys:manage
+// @Tags api-keys
+// @Param id path int true "API key ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 404 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /api-keys/{id} [delete]
+func (h *ApiKeyHandler) RevokeApiKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.BadRequest("invalid api key id")
+	}
+
+	if err := h.service.RevokeApiKey(c.Request().Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperrors.NotFound("api key not found or already revoked")
+		}
+
+		return apperrors.Internal(err, "unable to revoke api key")
+	}
+
+	requestLogger(c).WithField("api_key_id", id).Info("revoked api key")
+	return c.NoContent(http.StatusNoContent)
+}
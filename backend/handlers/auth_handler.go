@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+)
+
+type AuthHandler struct {
+	service services.AuthServiceInterface
+}
+
+func NewAuthHandler(service services.AuthServiceInterface) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// Login authenticates a staff account
+// @Summary Log in
+// @Description Exchange email and password for a short-lived access JWT and a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body entities.LoginRequest true "Credentials"
+// @Success 200 {object} entities.TokenPair
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Router /auth/login [post]
+func (h *AuthHandler) Login(c echo.Context) error {
+	var req entities.LoginRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind login request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	tokens, err := h.service.Login(c.Request().Context(), &req)
+	if err != nil {
+		return tokenError(err, "unable to log in")
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh rotates a refresh token
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and refresh token, the presented refresh token stops working
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body entities.RefreshRequest true "Refresh token"
+// @Success 200 {object} entities.TokenPair
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req entities.RefreshRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind refresh request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	tokens, err := h.service.Refresh(c.Request().Context(), &req)
+	if err != nil {
+		return tokenError(err, "unable to refresh tokens")
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the current tokens
+// @Summary Log out
+// @Description Revoke the access token of the request and, when given, the refresh token of the session
+// @Tags auth
+// @Accept json
+// @Param request body entities.LogoutRequest false "Refresh token to revoke"
+// @Success 204 "No Content"
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c echo.Context) error {
+	principal, _ := auth.PrincipalFromContext(c.Request().Context())
+	if principal.IsAPIKey() {
+		return apperrors.BadRequest("api keys are revoked through DELETE /api-keys/{id}")
+	}
+
+	var req entities.LogoutRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind logout request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	if err := h.service.Logout(c.Request().Context(), principal, req.RefreshToken); err != nil {
+		return apperrors.Internal(err, "unable to log out")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func tokenError(err error, message string) error {
+	if appErr := apperrors.From(err); appErr != nil {
+		return appErr
+	}
+
+	if errors.Is(err, services.ErrInvalidCredentials) || errors.Is(err, services.ErrInvalidRefreshToken) {
+		return apperrors.Unauthorized(err.Error())
+	}
+
+	return apperrors.Internal(err, message)
+}
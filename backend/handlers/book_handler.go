@@ -1,14 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"net/http"
 
+	"github.com/goesbams/mini-books-library/backend/apperrors"
 	"github.com/goesbams/mini-books-library/backend/entities"
 	"github.com/goesbams/mini-books-library/backend/services"
-	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/goesbams/mini-books-library/backend/tracing"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
@@ -28,20 +29,21 @@ func NewBookHandler(service services.BookServiceInterface) *BookHandler {
 // @Accept json
 // @Produce json
 // @Success 200 {array} entities.Book
-// @Failure 500 {object} map[string]interface{}
+// @Failure 500 {object} apperrors.Problem
 // @Router /books [get]
 func (h *BookHandler) GetBooks(c echo.Context) error {
-	books, err := h.service.GetBooks()
+	books, err := h.service.GetBooks(c.Request().Context())
 	if err != nil {
-		logrus.WithError(err).Error("failed to fetch books")
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error":   "internal server server",
-			"message": "unable to fetch books",
-		})
+		return apperrors.Internal(err, "unable to fetch books")
 	}
 
-	logrus.Info("fetched books successfully")
-	return c.JSON(http.StatusOK, books)
+	requestLogger(c).WithField("count", len(books)).Info("fetched books")
+
+	// the list is the largest response we send, time its encoding apart
+	_, span := tracing.Start(c.Request().Context(), "encode response")
+	err = c.JSON(http.StatusOK, books)
+	tracing.End(span, err)
+	return err
 }
 
 // AddBook adds a new book
@@ -57,44 +59,81 @@ func (h *BookHandler) GetBooks(c echo.Context) error {
 // @Param publication_date formData string true "Publication Date (YYYY-MM-DD)"
 // @Param number_of_pages formData int true "Number of Pages"
 // @Param isbn formData string true "ISBN (13 digits)"
+// @Param autofill query bool false "Fill missing fields from the metadata provider using the ISBN"
 // @Success 201 {object} entities.Book
-// @Failure 400 {object} map[string]interface{}
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /books [post]
 func (h *BookHandler) AddBook(c echo.Context) error {
 	var book entities.Book
 	if err := c.Bind(&book); err != nil {
-		logrus.WithError(err).Error("failed to bind book data")
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error":   "bad request",
-			"message": "invalid book data",
-		})
+		requestLogger(c).WithError(err).Error("failed to bind book data")
+		return apperrors.BadRequest("invalid book data")
 	}
 
-	if err := h.service.AddBook(&book); err != nil {
-		switch e := err.(type) {
-		case utils.ValidationError:
-			logrus.WithError(err).Warn("validation failed")
-
-			return c.JSON(http.StatusBadRequest, map[string]interface{}{
-				"error":   "bad_request",
-				"message": e.Errors,
-			})
-		default:
-			logrus.WithError(err).Error("failed to add book")
-
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error":   "internal_server_error",
-				"message": "unable to add book",
-			})
+	opts := services.AddBookOptions{Autofill: c.QueryParam("autofill") == "true"}
+
+	if err := h.service.AddBook(c.Request().Context(), &book, opts); err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			requestLogger(c).WithError(err).Warn("validation failed")
+			return appErr
 		}
+
+		return apperrors.Internal(err, "unable to add book")
 	}
 
-	logrus.Info("added new book successfully", book)
+	requestLogger(c).WithFields(logrus.Fields{"isbn": book.Isbn, "title": book.Title}).Info("added book")
 	return c.JSON(http.StatusCreated, map[string]interface{}{
 		"message": "book created successfully",
 	})
 }
 
+// LookupBook builds a pre-filled book draft from an ISBN
+// @Summary Lookup book metadata by ISBN
+// @Description Fetch bibliographic details from the metadata provider and return them as an unsaved book draft
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param isbn query string true "ISBN (13 digits)"
+// @Success 200 {object} entities.Book
+// @Failure 400 {object} apperrors.Problem
+// @Failure 404 {object} apperrors.Problem
+// @Failure 503 {object} apperrors.Problem
+// @Failure 504 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /books/lookup [post]
+func (h *BookHandler) LookupBook(c echo.Context) error {
+	isbn := c.QueryParam("isbn")
+
+	draft, err := h.service.LookupBook(c.Request().Context(), isbn)
+	if err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		if errors.Is(err, services.ErrMetadataNotFound) {
+			return apperrors.NotFound("no metadata found for isbn")
+		}
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			// timeouts, the provider's or the request's, are left to the
+			// error handler which answers 504
+			return apperrors.Internal(err, "failed to lookup metadata")
+		}
+
+		requestLogger(c).WithError(err).WithField("isbn", isbn).Error("failed to lookup metadata")
+		return apperrors.Unavailable("metadata provider is unavailable").Wrap(err)
+	}
+
+	requestLogger(c).WithField("isbn", isbn).Info("looked up metadata")
+	return c.JSON(http.StatusOK, draft)
+}
+
 // GetBookByID retrieves a book by its ID
 // @Summary Get book by ID
 // @Description Get detailed information about a book by its ID
@@ -103,30 +142,23 @@ func (h *BookHandler) AddBook(c echo.Context) error {
 // @Produce json
 // @Param id path int true "Book ID"
 // @Success 200 {object} entities.Book
-// @Failure 404 {object} map[string]string "Book not found"
-// @Failure 500 {object} map[string]string "Internal server error"
+// @Failure 404 {object} apperrors.Problem "Book not found"
+// @Failure 500 {object} apperrors.Problem "Internal server error"
 // @Router /books/{id} [get]
 func (h *BookHandler) GetBookById(c echo.Context) error {
 	id := c.Param("id")
 
-	book, err := h.service.GetBookById(id)
+	book, err := h.service.GetBookById(c.Request().Context(), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			logrus.WithError(err).Warn(fmt.Sprintf("book with id:%s not found", id))
-			return c.JSON(http.StatusNotFound, map[string]string{
-				"error":   "not_found",
-				"message": "book not found",
-			})
+			requestLogger(c).WithField("book_id", id).Warn("book not found")
+			return apperrors.NotFound("book not found")
 		}
 
-		logrus.WithError(err).Error(fmt.Sprintf("failed to fetch book by id: %s", id))
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error":   "internal_server_error",
-			"message": "something went wrong while fetching book",
-		})
+		return apperrors.Internal(err, "something went wrong while fetching book")
 	}
 
-	logrus.Info(fmt.Sprintf("get book by id:%d title:%s successfully", book.ID, book.Title))
+	requestLogger(c).WithFields(logrus.Fields{"book_id": book.ID, "title": book.Title}).Info("fetched book")
 	return c.JSON(http.StatusOK, book)
 }
 
@@ -145,46 +177,37 @@ func (h *BookHandler) GetBookById(c echo.Context) error {
 // @Param number_of_pages formData int false "Number of Pages"
 // @Param isbn formData string false "ISBN (13 digits)"
 // @Success 200 {object} entities.Book
-// @Failure 400 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} apperrors.Problem
+// @Failure 404 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /books/{id} [put]
 func (h *BookHandler) UpdateBook(c echo.Context) error {
 	id := c.Param("id")
 
 	var book entities.Book
 	if err := c.Bind(&book); err != nil {
-		logrus.WithError(err).Error("failed to bind book data")
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error":   "bad_request",
-			"message": "invalid book data",
-		})
+		requestLogger(c).WithError(err).Error("failed to bind book data")
+		return apperrors.BadRequest("invalid book data")
 	}
 
 	// call service
-	if err := h.service.UpdateBook(id, &book); err != nil {
+	if err := h.service.UpdateBook(c.Request().Context(), id, &book); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return c.JSON(http.StatusNotFound, map[string]string{
-				"error":   "not_found",
-				"message": "book not found",
-			})
+			return apperrors.NotFound("book not found")
 		}
 
-		if verr, ok := err.(utils.ValidationError); ok {
-			return c.JSON(http.StatusBadRequest, map[string]interface{}{
-				"error":   "bad_request",
-				"message": verr.Errors,
-			})
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
 		}
 
-		logrus.WithError(err).Error("failed to update book")
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error":   "internal_server_error",
-			"message": "unable to update book",
-		})
+		return apperrors.Internal(err, "unable to update book")
 	}
 
-	logrus.Infof("updated book id:%s title:%s successfully", id, book.Title)
+	requestLogger(c).WithFields(logrus.Fields{"book_id": id, "title": book.Title}).Info("updated book")
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "book updated successfully",
 	})
@@ -198,27 +221,24 @@ func (h *BookHandler) UpdateBook(c echo.Context) error {
 // @Produce json
 // @Param id path int true "Book ID"
 // @Success 204 {string} string "No Content"
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 404 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /books/{id} [delete]
 func (h *BookHandler) DeleteBook(c echo.Context) error {
 	id := c.Param("id")
 
-	if err := h.service.DeleteBook(id); err != nil {
+	if err := h.service.DeleteBook(c.Request().Context(), id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return c.JSON(http.StatusNotFound, map[string]string{
-				"error":   "not_found",
-				"message": "book not found",
-			})
+			return apperrors.NotFound("book not found")
 		}
 
-		logrus.WithError(err).Error("failed to delete book")
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error":   "internal_server_error",
-			"message": "unable to delete book",
-		})
+		return apperrors.Internal(err, "unable to delete book")
 	}
 
-	logrus.Infof("deleted book id: %s successfully", id)
+	requestLogger(c).WithField("book_id", id).Info("deleted book")
 	return c.NoContent(http.StatusNoContent)
 }
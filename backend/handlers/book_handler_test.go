@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/middleware"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+)
+
+type fakeLookupService struct {
+	services.BookServiceInterface
+	err error
+}
+
+func (s fakeLookupService) LookupBook(ctx context.Context, isbn string) (entities.Book, error) {
+	return entities.Book{}, s.err
+}
+
+func TestLookupBookErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "not found", err: services.ErrMetadataNotFound, wantStatus: http.StatusNotFound},
+		{name: "provider down", err: fmt.Errorf("%w: unexpected status 500", services.ErrMetadataUnavailable), wantStatus: http.StatusServiceUnavailable},
+		{name: "provider timeout", err: fmt.Errorf("%w: %w", services.ErrMetadataUnavailable, context.DeadlineExceeded), wantStatus: http.StatusGatewayTimeout},
+		{name: "disabled", err: services.ErrMetadataDisabled, wantStatus: http.StatusServiceUnavailable},
+		{name: "other failure", err: errors.New("boom"), wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.HTTPErrorHandler = middleware.HTTPErrorHandler
+			e.POST("/books/lookup", NewBookHandler(fakeLookupService{err: tt.err}).LookupBook)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/books/lookup?isbn=9780140328721", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
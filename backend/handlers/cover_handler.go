@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/goesbams/mini-books-library/backend/storage"
+	"github.com/labstack/echo/v4"
+)
+
+// coverCacheControl lets clients and CDNs keep covers but revalidate them
+// with the ETag on every use, a re-upload keeps the same URLs.
+const coverCacheControl = "public, no-cache"
+
+type CoverHandler struct {
+	service       services.CoverServiceInterface
+	maxUploadSize int64
+}
+
+func NewCoverHandler(service services.CoverServiceInterface, maxUploadSize int64) *CoverHandler {
+	return &CoverHandler{service: service, maxUploadSize: maxUploadSize}
+}
+
+// UploadCover stores a cover image for a book
+// @Summary Upload a book cover
+// @Description Upload a JPEG, PNG or WebP cover image, thumbnails are generated automatically
+// @Tags covers
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param cover formData file true "Cover image"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperrors.Problem
+// @Failure 404 {object} apperrors.Problem
+// @Failure 413 {object} apperrors.Problem
+// @Failure 415 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /books/{id}/cover [post]
+func (h *CoverHandler) UploadCover(c echo.Context) error {
+	id := c.Param("id")
+
+	// leave room for the multipart envelope around the file itself
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.maxUploadSize+1<<20)
+
+	fileHeader, err := c.FormFile("cover")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return apperrors.PayloadTooLarge(services.ErrImageTooLarge.Error())
+		}
+
+		return apperrors.BadRequest("cover file is required")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		requestLogger(c).WithError(err).Error("failed to open uploaded cover")
+		return apperrors.BadRequest("unable to read cover file")
+	}
+	defer file.Close()
+
+	if err := h.service.UploadCover(c.Request().Context(), id, file); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return apperrors.NotFound("book not found")
+		case errors.Is(err, services.ErrImageTooLarge):
+			return apperrors.PayloadTooLarge(err.Error())
+		case errors.Is(err, services.ErrUnsupportedImage):
+			return apperrors.UnsupportedMediaType(err.Error())
+		}
+
+		return apperrors.Internal(err, "unable to upload cover")
+	}
+
+	requestLogger(c).WithField("book_id", id).Info("uploaded cover")
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"message": "cover uploaded successfully",
+	})
+}
+
+// GetCover serves the original cover image of a book
+// @Summary Get a book cover
+// @Description Serve the originally uploaded cover image
+// @Tags covers
+// @Produce image/jpeg,image/png,image/webp
+// @Param id path int true "Book ID"
+// @Success 200 {file} file
+// @Failure 404 {object} apperrors.Problem
+// @Router /books/{id}/cover [get]
+func (h *CoverHandler) GetCover(c echo.Context) error {
+	return h.serveCover(c, "")
+}
+
+// GetCoverThumbnail serves a resized cover image of a book
+// @Summary Get a book cover thumbnail
+// @Description Serve a JPEG thumbnail of the cover (small, medium or large)
+// @Tags covers
+// @Produce image/jpeg
+// @Param id path int true "Book ID"
+// @Param size path string true "Thumbnail size" Enums(small, medium, large)
+// @Success 200 {file} file
+// @Failure 404 {object} apperrors.Problem
+// @Router /books/{id}/cover/{size} [get]
+func (h *CoverHandler) GetCoverThumbnail(c echo.Context) error {
+	return h.serveCover(c, c.Param("size"))
+}
+
+func (h *CoverHandler) serveCover(c echo.Context, size string) error {
+	id := c.Param("id")
+
+	blob, info, err := h.service.GetCover(c.Request().Context(), id, size)
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) || errors.Is(err, services.ErrUnknownCoverSize) {
+			return apperrors.NotFound("cover not found")
+		}
+
+		return apperrors.Internal(err, "unable to fetch cover")
+	}
+	defer blob.Close()
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime.UnixNano(), info.Size)
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", coverCacheControl)
+	header.Set("ETag", etag)
+	if info.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+
+	return c.Stream(http.StatusOK, info.ContentType, blob)
+}
+
+// GetBrokenCovers reports covers that failed their last health check
+// @Summary List broken covers
+// @Description List books whose cover_image_url failed the last background health check
+// @Tags covers
+// @Produce json
+// @Success 200 {array} entities.CoverCheck
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /covers/broken [get]
+func (h *CoverHandler) GetBrokenCovers(c echo.Context) error {
+	checks, err := h.service.GetBrokenCovers(c.Request().Context())
+	if err != nil {
+		return apperrors.Internal(err, "unable to fetch broken covers")
+	}
+
+	return c.JSON(http.StatusOK, checks)
+}
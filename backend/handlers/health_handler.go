@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/health"
+	"github.com/labstack/echo/v4"
+)
+
+type HealthHandler struct {
+	checks *health.Registry
+}
+
+func NewHealthHandler(checks *health.Registry) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// Liveness reports the process is up
+// @Summary Liveness probe
+// @Description Answers as long as the process serves HTTP, it checks no dependency so a database outage doesn't get the process restarted
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, health.Report{Status: health.StatusUp, Checks: []health.CheckResult{}})
+}
+
+// Readiness reports whether the service can take traffic
+// @Summary Readiness probe
+// @Description Run the dependency checks: database ping, schema at the latest migration and optional dependencies such as Redis. Optional failures report the service as degraded without failing the probe
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c echo.Context) error {
+	report := h.checks.Run(c.Request().Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+		failed := make(map[string]string)
+		for _, check := range report.Checks {
+			if check.Status == health.StatusDown {
+				failed[check.Name] = check.Error
+			}
+		}
+		requestLogger(c).WithField("failed", failed).Warn("not ready")
+	}
+
+	return c.JSON(status, report)
+}
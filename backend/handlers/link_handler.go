@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+)
+
+type LinkHandler struct {
+	service services.LinkServiceInterface
+}
+
+func NewLinkHandler(service services.LinkServiceInterface) *LinkHandler {
+	return &LinkHandler{service: service}
+}
+
+// CreateLink creates a short link
+// @Summary Create a short link
+// @Description Create a short code for a URL, either random or a custom slug, with an optional expiry
+// @Tags links
+// @Accept json
+// @Produce json
+// @Param request body entities.CreateShortLinkRequest true "Target URL, optional slug and expiry"
+// @Success 201 {object} entities.ShortLink
+// @Failure 400 {object} apperrors.Problem
+// @Failure 409 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /links [post]
+func (h *LinkHandler) CreateLink(c echo.Context) error {
+	var req entities.CreateShortLinkRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind short link request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	link, err := h.service.CreateLink(c.Request().Context(), &req)
+	if err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		if errors.Is(err, services.ErrLinkCodeTaken) {
+			return apperrors.Conflict(err.Error())
+		}
+
+		return apperrors.Internal(err, "unable to create short link")
+	}
+
+	requestLogger(c).WithField("code", link.Code).Info("created short link")
+	return c.JSON(http.StatusCreated, link)
+}
+
+// FollowLink redirects a short code to its target
+// @Summary Follow a short link
+// @Description Redirect to the target URL of a short code and count the click
+// @Tags links
+// @Param code path string true "Short code"
+// @Success 302 {string} string "Found"
+// @Failure 404 {object} apperrors.Problem
+// @Failure 410 {object} apperrors.Problem
+// @Router /s/{code} [get]
+func (h *LinkHandler) FollowLink(c echo.Context) error {
+	code := c.Param("code")
+
+	link, err := h.service.FollowLink(c.Request().Context(), code, c.Request().Referer(), c.Request().UserAgent())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperrors.NotFound("short link not found")
+		}
+
+		if errors.Is(err, services.ErrLinkExpired) {
+			return apperrors.Gone(err.Error())
+		}
+
+		return apperrors.Internal(err, "unable to follow short link")
+	}
+
+	return c.Redirect(http.StatusFound, link.TargetUrl)
+}
+
+// GetLinkStats returns click analytics of a short link
+// @Summary Get short link stats
+// @Description Click counts of a short link per day, referrer host and user agent family
+// @Tags links
+// @Produce json
+// @Param code path string true "Short code"
+// @Success 200 {object} entities.ShortLinkStats
+// @Failure 404 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /links/{code}/stats [get]
+func (h *LinkHandler) GetLinkStats(c echo.Context) error {
+	code := c.Param("code")
+
+	stats, err := h.service.GetLinkStats(c.Request().Context(), code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperrors.NotFound("short link not found")
+		}
+
+		return apperrors.Internal(err, "unable to fetch short link stats")
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
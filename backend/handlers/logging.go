@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// requestLogger returns the logger of the request, it carries the request
+// ID, route and user.
+func requestLogger(c echo.Context) *logrus.Entry {
+	return utils.LoggerFromContext(c.Request().Context())
+}
@@ -1,62 +1,248 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/goesbams/mini-books-library/backend/apperrors"
 	"github.com/goesbams/mini-books-library/backend/entities"
 	"github.com/goesbams/mini-books-library/backend/services"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
 
+// maxBatchItemSize bounds the body of a JSON batch per allowed item, well
+// above what a URL request takes.
+const maxBatchItemSize = 4096
+
 type UrlHandler struct {
-	service services.UrlServiceInterface
+	service       services.UrlServiceInterface
+	batch         *services.UrlBatchProcessor
+	maxBatchItems int
 }
 
-func NewUrlHandler(service services.UrlServiceInterface) *UrlHandler {
+func NewUrlHandler(service services.UrlServiceInterface, batch *services.UrlBatchProcessor, maxBatchItems int) *UrlHandler {
 	return &UrlHandler{
-		service: service,
+		service:       service,
+		batch:         batch,
+		maxBatchItems: maxBatchItems,
 	}
 }
 
 // ProcessURL processes URL cleanup and redirection
 // @Summary Process URL cleanup/redirection
-// @Description Clean or redirect a given URL based on operation type (canonical, redirection, all)
+// @Description Clean or redirect a given URL with one of the operations listed by GET /urls/operations. The resolve operation follows live HTTP redirects and returns every hop. Set explain to true to get the URL after every step and which components each step changed, along with the rule responsible
 // @Tags urls
 // @Accept json
 // @Produce json
 // @Param request body entities.URLRequest true "URL and Operation"
 // @Success 200 {object} entities.URLResponse
-// @Failure 400 {object} map[string]interface{}
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 502 {object} apperrors.Problem
+// @Failure 504 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /urls/process [post]
 func (h *UrlHandler) ProcessUrl(c echo.Context) error {
 	var req entities.URLRequest
 	if err := c.Bind(&req); err != nil {
-		logrus.WithError(err).Error("failed to bind url request")
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error":   "bad_request",
-			"message": "invalid input format",
-		})
+		requestLogger(c).WithError(err).Error("failed to bind url request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	if err := h.service.ValidateRequest(req); err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		return apperrors.BadRequest(err.Error())
+	}
+
+	if req.Explain {
+		explanation, err := h.service.ExplainUrl(c.Request().Context(), req.URL, req.Operation)
+		if err != nil {
+			requestLogger(c).WithError(err).Error("failed to explain url")
+			return urlError(err, "unable to explain url").With("steps", explanation.Steps)
+		}
+
+		requestLogger(c).WithFields(logrus.Fields{"operation": req.Operation, "steps": len(explanation.Steps), "result": explanation.FinalURL}).Info("explained url")
+		return c.JSON(http.StatusOK, entities.URLResponse{ProcessedURL: explanation.FinalURL, Steps: explanation.Steps})
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error":   "validation_error",
-			"message": err.Error(),
-		})
+	if req.Operation == "resolve" {
+		resolution, err := h.service.ResolveUrl(c.Request().Context(), req.URL)
+		if err != nil {
+			requestLogger(c).WithError(err).Error("failed to resolve url")
+			return urlError(err, "unable to resolve url").With("hops", resolution.Hops)
+		}
+
+		requestLogger(c).WithFields(logrus.Fields{"hops": len(resolution.Hops), "result": resolution.FinalURL}).Info("resolved url")
+		return c.JSON(http.StatusOK, entities.URLResponse{ProcessedURL: resolution.FinalURL, Hops: resolution.Hops})
 	}
 
-	processed, err := h.service.ProcessUrl(req.URL, req.Operation)
+	processed, err := h.service.ProcessUrl(c.Request().Context(), req.URL, req.Operation)
 	if err != nil {
-		logrus.WithError(err).Error("failed to process url")
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error":   "processing_error",
-			"message": err.Error(),
-		})
+		requestLogger(c).WithError(err).Error("failed to process url")
+		return urlError(err, "unable to process url")
 	}
 
-	logrus.Infof("processed url operation:%s result:%s", req.Operation, processed)
+	requestLogger(c).WithFields(logrus.Fields{"operation": req.Operation, "result": processed}).Info("processed url")
 	return c.JSON(http.StatusOK, entities.URLResponse{ProcessedURL: processed})
 }
+
+// urlError tells the client what is wrong with its URL and reports an
+// unreachable destination as a 502. Anything else, a deadline included, is
+// left to the error handler behind detail.
+func urlError(err error, detail string) *apperrors.Error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return apperrors.Internal(err, detail)
+	case errors.Is(err, services.ErrInvalidURL), errors.Is(err, services.ErrRedirectLoop),
+		errors.Is(err, services.ErrTooManyHops), errors.Is(err, services.ErrBlockedAddress):
+		return apperrors.BadRequest(err.Error()).Wrap(err)
+	case errors.Is(err, services.ErrUnreachable):
+		return apperrors.BadGateway(err.Error()).Wrap(err)
+	}
+
+	return apperrors.Internal(err, detail)
+}
+
+// ProcessUrlBatch processes many URLs in one request
+// @Summary Process a batch of URLs
+// @Description Process an array of URL requests concurrently, results keep the input order and report success or error per item. Send Content-Type application/x-ndjson to stream one request per line and receive one result per line. Both are limited to urls.batch.max_items items and urls.batch.timeout.
+// @Tags urls
+// @Accept json,application/x-ndjson
+// @Produce json,application/x-ndjson
+// @Param request body []entities.URLRequest true "URLs and operations"
+// @Success 200 {object} entities.URLBatchResponse
+// @Failure 400 {object} apperrors.Problem
+// @Failure 413 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 504 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /urls/process/batch [post]
+func (h *UrlHandler) ProcessUrlBatch(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "application/x-ndjson") {
+		return h.processUrlStream(c)
+	}
+
+	tooLarge := apperrors.PayloadTooLarge(fmt.Sprintf("batch exceeds %d items, use application/x-ndjson for larger inputs", h.maxBatchItems))
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, int64(h.maxBatchItems)*maxBatchItemSize)
+
+	reqs, err := h.decodeBatch(c.Request().Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.Is(err, services.ErrBatchTooLarge) || errors.As(err, &maxErr) {
+			return tooLarge
+		}
+		requestLogger(c).WithError(err).Error("failed to bind url batch request")
+		return apperrors.BadRequest("invalid input format, expected an array of url requests")
+	}
+
+	resp := entities.URLBatchResponse{Results: h.batch.ProcessBatch(ctx, reqs)}
+	if err := ctx.Err(); err != nil {
+		// the batch deadline passed or the client left, the results are partial
+		return err
+	}
+	for _, result := range resp.Results {
+		if result.Error != "" {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+	}
+
+	requestLogger(c).WithFields(logrus.Fields{"items": len(resp.Results), "failed": resp.Failed}).Info("processed url batch")
+	return c.JSON(http.StatusOK, resp)
+}
+
+// decodeBatch reads a JSON array of requests one element at a time, so an
+// oversized batch is refused without decoding all of it.
+func (h *UrlHandler) decodeBatch(r io.Reader) ([]entities.URLRequest, error) {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil {
+		return nil, err
+	} else if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array, got %v", token)
+	}
+
+	var reqs []entities.URLRequest
+	for decoder.More() {
+		if len(reqs) == h.maxBatchItems {
+			return nil, services.ErrBatchTooLarge
+		}
+
+		var req entities.URLRequest
+		if err := decoder.Decode(&req); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+func (h *UrlHandler) processUrlStream(c echo.Context) error {
+	res := c.Response()
+
+	// an HTTP/1 server closes the request body once the response starts
+	// unless both directions are enabled, HTTP/2 streams always are
+	if err := http.NewResponseController(res.Writer).EnableFullDuplex(); err != nil && c.Request().ProtoMajor == 1 {
+		requestLogger(c).WithError(err).Warn("full duplex unavailable, the url batch input may be cut short")
+	}
+
+	res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	res.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(res)
+	count := 0
+
+	err := h.batch.ProcessStream(c.Request().Context(), c.Request().Body, h.maxBatchItems, func(result entities.URLBatchResult) error {
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		res.Flush()
+		count++
+		return nil
+	})
+	if errors.Is(err, services.ErrBatchInput) || errors.Is(err, services.ErrBatchTooLarge) || errors.Is(err, context.DeadlineExceeded) {
+		// the status is already sent, a last line tells the client the
+		// results stop short of its input
+		requestLogger(c).WithError(err).WithField("items", count).Warn("url batch stopped early")
+		encoder.Encode(entities.URLBatchStreamError{Error: err.Error(), Processed: count})
+		return nil
+	}
+	if err != nil {
+		// the client is gone, all we can do is log and stop
+		requestLogger(c).WithError(err).Error("failed to stream url batch")
+		return nil
+	}
+
+	requestLogger(c).WithField("items", count).Info("streamed url batch")
+	return nil
+}
+
+// GetOperations lists the available URL operations
+// @Summary List URL operations
+// @Description List every operation and configured pipeline accepted by the operation field
+// @Tags urls
+// @Produce json
+// @Success 200 {array} entities.URLOperationInfo
+// @Router /urls/operations [get]
+func (h *UrlHandler) GetOperations(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.Operations())
+}
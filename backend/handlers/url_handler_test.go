@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/goesbams/mini-books-library/backend/middleware"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestUrlServer(t *testing.T, resolve services.ResolverOptions, requestTimeout time.Duration) *echo.Echo {
+	t.Helper()
+
+	redirector, err := services.NewRedirector(config.RedirectConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := services.NewDefaultOperationRegistry(redirector, services.NewTrackingStripper(config.TrackingConfig{}), services.NewResolver(resolve), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := services.NewUrlService(registry, services.NewResolver(resolve))
+	handler := NewUrlHandler(service, services.NewUrlBatchProcessor(service, 1), 10)
+
+	e := echo.New()
+	e.HTTPErrorHandler = middleware.HTTPErrorHandler
+	e.Use(middleware.Timeout(requestTimeout, "/urls/process/batch"))
+	e.POST("/urls/process", handler.ProcessUrl)
+	e.POST("/urls/process/batch", handler.ProcessUrlBatch, middleware.Timeout(requestTimeout))
+	return e
+}
+
+func TestProcessUrlErrorStatus(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	loop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	}))
+	defer loop.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	private := services.ResolverOptions{MaxHops: 5, Timeout: 5 * time.Second, AllowPrivate: true}
+	tests := []struct {
+		name       string
+		resolve    services.ResolverOptions
+		body       string
+		wantStatus int
+	}{
+		{name: "invalid url", resolve: private, body: `{"url": "http://exa mple.com/", "operation": "normalize"}`, wantStatus: http.StatusBadRequest},
+		{name: "redirect loop", resolve: private, body: `{"url": "` + loop.URL + `/", "operation": "resolve"}`, wantStatus: http.StatusBadRequest},
+		{name: "blocked address", resolve: services.ResolverOptions{MaxHops: 5, Timeout: 5 * time.Second}, body: `{"url": "` + loop.URL + `/", "operation": "resolve"}`, wantStatus: http.StatusBadRequest},
+		{name: "unreachable destination", resolve: private, body: `{"url": "` + closed.URL + `/", "operation": "resolve"}`, wantStatus: http.StatusBadGateway},
+		{name: "request deadline", resolve: private, body: `{"url": "` + slow.URL + `/", "operation": "resolve"}`, wantStatus: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestUrlServer(t, tt.resolve, 100*time.Millisecond)
+
+			req := httptest.NewRequest(http.MethodPost, "/urls/process", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestProcessUrlBatchLimits(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	var lines, resolves []string
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf(`{"url": "https://example.com/%d", "operation": "normalize"}`, i))
+	}
+	for i := 0; i < 3; i++ {
+		resolves = append(resolves, `{"url": "`+slow.URL+`/", "operation": "resolve"}`)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantResults int
+		wantError   string
+	}{
+		{name: "json over max items", contentType: echo.MIMEApplicationJSON, body: "[" + strings.Join(lines, ",") + "]", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "json past the deadline", contentType: echo.MIMEApplicationJSON, body: "[" + strings.Join(resolves, ",") + "]", wantStatus: http.StatusGatewayTimeout},
+		{name: "stream within max items", contentType: "application/x-ndjson", body: strings.Join(lines[:10], "\n"), wantStatus: http.StatusOK, wantResults: 10},
+		{name: "stream over max items", contentType: "application/x-ndjson", body: strings.Join(lines, "\n"), wantStatus: http.StatusOK, wantResults: 10, wantError: "batch too large"},
+		{name: "stream past the deadline", contentType: "application/x-ndjson", body: strings.Join(resolves, "\n"), wantStatus: http.StatusOK, wantError: "deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestUrlServer(t, services.ResolverOptions{MaxHops: 5, Timeout: 5 * time.Second, AllowPrivate: true}, 100*time.Millisecond)
+
+			req := httptest.NewRequest(http.MethodPost, "/urls/process/batch", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.contentType != "application/x-ndjson" {
+				return
+			}
+
+			results, streamErr := 0, ""
+			decoder := json.NewDecoder(rec.Body)
+			for decoder.More() {
+				// results and the closing error share the error field
+				var line struct {
+					Error     string `json:"error"`
+					Processed *int   `json:"processed"`
+				}
+				if err := decoder.Decode(&line); err != nil {
+					t.Fatal(err)
+				}
+				if line.Processed != nil {
+					streamErr = line.Error
+					continue
+				}
+				results++
+			}
+
+			if tt.wantResults > 0 && results != tt.wantResults {
+				t.Errorf("%d results, want %d", results, tt.wantResults)
+			}
+			if !strings.Contains(streamErr, tt.wantError) || (tt.wantError == "") != (streamErr == "") {
+				t.Errorf("stream error %q, want %q", streamErr, tt.wantError)
+			}
+		})
+	}
+}
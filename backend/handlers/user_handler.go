@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type UserHandler struct {
+	service services.UserServiceInterface
+}
+
+func NewUserHandler(service services.UserServiceInterface) *UserHandler {
+	return &UserHandler{service: service}
+}
+
+// GetUsers lists staff accounts
+// @Summary Get all users
+// @Description List staff accounts with their role, requires members:manage
+// @Tags users
+// @Produce json
+// @Success 200 {array} entities.User
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /users [get]
+func (h *UserHandler) GetUsers(c echo.Context) error {
+	users, err := h.service.GetUsers(c.Request().Context())
+	if err != nil {
+		return apperrors.Internal(err, "unable to fetch users")
+	}
+
+	return c.JSON(http.StatusOK, users)
+}
+
+// CreateUser creates a staff account
+// @Summary Create a user
+// @Description Create a staff account with a role (viewer, librarian or admin), requires members:manage
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body entities.CreateUserRequest true "Email, password and role"
+// @Success 201 {object} entities.User
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 409 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /users [post]
+func (h *UserHandler) CreateUser(c echo.Context) error {
+	var req entities.CreateUserRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind user request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	user, err := h.service.CreateUser(c.Request().Context(), &req)
+	if err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		if errors.Is(err, services.ErrEmailTaken) {
+			return apperrors.Conflict(err.Error())
+		}
+
+		return apperrors.Internal(err, "unable to create user")
+	}
+
+	requestLogger(c).WithFields(logrus.Fields{"user_id": user.ID, "role": user.Role}).Info("created user")
+	return c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUserRole changes the role of a staff account
+// @Summary Change a user's role
+// @Description Set the role of a staff account, it applies from the user's next token refresh. Requires members:manage
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body entities.UpdateUserRoleRequest true "New role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperrors.Problem
+// @Failure 401 {object} apperrors.Problem
+// @Failure 403 {object} apperrors.Problem
+// @Failure 404 {object} apperrors.Problem
+// @Failure 500 {object} apperrors.Problem
+// @Security BearerAuth
+// @Router /users/{id}/role [put]
+func (h *UserHandler) UpdateUserRole(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return apperrors.BadRequest("invalid user id")
+	}
+
+	var req entities.UpdateUserRoleRequest
+	if err := c.Bind(&req); err != nil {
+		requestLogger(c).WithError(err).Error("failed to bind user role request")
+		return apperrors.BadRequest("invalid input format")
+	}
+
+	if err := h.service.UpdateUserRole(c.Request().Context(), id, &req); err != nil {
+		if appErr := apperrors.From(err); appErr != nil {
+			return appErr
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperrors.NotFound("user not found")
+		}
+
+		return apperrors.Internal(err, "unable to update user role")
+	}
+
+	requestLogger(c).WithFields(logrus.Fields{"user_id": id, "role": req.Role}).Info("updated user role")
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "user role updated successfully",
+	})
+}
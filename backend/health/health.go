@@ -0,0 +1,150 @@
+// Package health runs the dependency checks behind the readiness endpoint.
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Checker reports whether a dependency is usable, a nil error means it is.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Status string
+
+const (
+	StatusUp Status = "up"
+	// StatusDegraded means only optional checks failed, the service still
+	// takes traffic.
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    Status  `json:"status"`
+	Optional  bool    `json:"optional,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type check struct {
+	name     string
+	checker  Checker
+	optional bool
+}
+
+// Registry holds the checks of the service, they run concurrently and each
+// gets the same timeout.
+type Registry struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a check the service can't work without, its failure takes
+// the service out of rotation.
+func (r *Registry) Register(name string, checker Checker) {
+	r.add(check{name: name, checker: checker})
+}
+
+// RegisterOptional adds a check whose failure is reported without failing
+// readiness, for dependencies the service degrades gracefully without.
+func (r *Registry) RegisterOptional(name string, checker Checker) {
+	r.add(check{name: name, checker: checker, optional: true})
+}
+
+func (r *Registry) add(c check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, c)
+}
+
+// Drain fails readiness from now on, so load balancers stop sending traffic
+// while the server shuts down.
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Run runs every check and sums them up in a report.
+func (r *Registry) Run(ctx context.Context) Report {
+	if r.draining.Load() {
+		return Report{
+			Status: StatusDown,
+			Checks: []CheckResult{{Name: "shutdown", Status: StatusDown, Error: "shutting down"}},
+		}
+	}
+
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if !result.Optional {
+			report.Status = StatusDown
+			break
+		}
+		report.Status = StatusDegraded
+	}
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	result := CheckResult{
+		Name:      c.name,
+		Status:    StatusUp,
+		Optional:  c.optional,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
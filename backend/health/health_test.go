@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	up   = CheckerFunc(func(context.Context) error { return nil })
+	down = CheckerFunc(func(context.Context) error { return errors.New("connection refused") })
+)
+
+func TestRegistryStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		required []Checker
+		optional []Checker
+		want     Status
+	}{
+		{name: "no checks", want: StatusUp},
+		{name: "all up", required: []Checker{up, up}, optional: []Checker{up}, want: StatusUp},
+		{name: "optional down", required: []Checker{up}, optional: []Checker{down, up}, want: StatusDegraded},
+		{name: "required down", required: []Checker{up, down}, optional: []Checker{up}, want: StatusDown},
+		{name: "required wins over optional", required: []Checker{down}, optional: []Checker{down}, want: StatusDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(time.Second)
+			for i, checker := range tt.required {
+				registry.Register("required-"+string(rune('a'+i)), checker)
+			}
+			for i, checker := range tt.optional {
+				registry.RegisterOptional("optional-"+string(rune('a'+i)), checker)
+			}
+
+			report := registry.Run(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("status %s, want %s: %+v", report.Status, tt.want, report.Checks)
+			}
+			if len(report.Checks) != len(tt.required)+len(tt.optional) {
+				t.Errorf("%d results for %d checks", len(report.Checks), len(tt.required)+len(tt.optional))
+			}
+		})
+	}
+}
+
+func TestRegistryResults(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	registry.Register("postgres", up)
+	registry.RegisterOptional("metadata", down)
+	registry.Register("cover-store", up)
+
+	report := registry.Run(context.Background())
+
+	var names []string
+	for _, result := range report.Checks {
+		names = append(names, result.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"cover-store", "metadata", "postgres"}) {
+		t.Errorf("results %v, want them sorted by name", names)
+	}
+
+	metadata := report.Checks[1]
+	if metadata.Status != StatusDown || !metadata.Optional || metadata.Error != "connection refused" {
+		t.Errorf("metadata result %+v", metadata)
+	}
+	if postgres := report.Checks[2]; postgres.Status != StatusUp || postgres.Optional || postgres.Error != "" {
+		t.Errorf("postgres result %+v", postgres)
+	}
+}
+
+func TestRegistryTimeout(t *testing.T) {
+	hang := CheckerFunc(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+
+	registry := NewRegistry(100 * time.Millisecond)
+	registry.Register("postgres", hang)
+	registry.Register("redis", hang)
+	registry.Register("s3", hang)
+	registry.Register("fast", up)
+
+	start := time.Now()
+	report := registry.Run(context.Background())
+
+	// the checks run side by side, each stopped at its own timeout
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Run took %s, the checks didn't run concurrently", elapsed)
+	}
+	if report.Status != StatusDown {
+		t.Errorf("status %s, want down", report.Status)
+	}
+	for _, result := range report.Checks {
+		if result.Name == "fast" {
+			if result.Status != StatusUp {
+				t.Errorf("fast check %+v", result)
+			}
+			continue
+		}
+		if result.Status != StatusDown || !strings.Contains(result.Error, "deadline exceeded") || result.LatencyMs < 100 {
+			t.Errorf("%s result %+v, want down at the timeout", result.Name, result)
+		}
+	}
+}
+
+func TestRegistryDrain(t *testing.T) {
+	calls := 0
+	registry := NewRegistry(time.Second)
+	registry.Register("postgres", CheckerFunc(func(context.Context) error {
+		calls++
+		return nil
+	}))
+
+	if report := registry.Run(context.Background()); report.Status != StatusUp {
+		t.Fatalf("status %s before draining", report.Status)
+	}
+
+	registry.Drain()
+	report := registry.Run(context.Background())
+	if report.Status != StatusDown || len(report.Checks) != 1 || report.Checks[0].Name != "shutdown" {
+		t.Errorf("report while draining %+v", report)
+	}
+	if calls != 1 {
+		t.Errorf("checks ran %d times, draining should skip them", calls)
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// domainQueryTimeout keeps a slow database from stalling scrapes.
+const domainQueryTimeout = 2 * time.Second
+
+// domainGauge is a gauge read from the database on every scrape.
+type domainGauge struct {
+	desc  *prometheus.Desc
+	query string
+}
+
+// domainCollector reports library totals. They are counted at scrape time
+// so they stay right across replicas and direct database changes.
+type domainCollector struct {
+	db     *sqlx.DB
+	gauges []domainGauge
+}
+
+func newDomainCollector(db *sqlx.DB) *domainCollector {
+	gauge := func(name, help, query string) domainGauge {
+		return domainGauge{
+			desc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil),
+			query: query,
+		}
+	}
+
+	return &domainCollector{
+		db: db,
+		gauges: []domainGauge{
+			gauge("books", "Books in the library.", "SELECT COUNT(*) FROM books"),
+			gauge("short_links", "Short links created.", "SELECT COUNT(*) FROM short_links"),
+			gauge("broken_covers", "Books whose cover failed its last health check.", "SELECT COUNT(*) FROM cover_checks WHERE NOT healthy"),
+		},
+	}
+}
+
+func (c *domainCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, gauge := range c.gauges {
+		ch <- gauge.desc
+	}
+}
+
+func (c *domainCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), domainQueryTimeout)
+	defer cancel()
+
+	for _, gauge := range c.gauges {
+		var count float64
+		if err := c.db.GetContext(ctx, &count, gauge.query); err != nil {
+			ch <- prometheus.NewInvalidMetric(gauge.desc, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(gauge.desc, prometheus.GaugeValue, count)
+	}
+}
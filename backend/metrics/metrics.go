@@ -0,0 +1,92 @@
+// Package metrics holds the Prometheus collectors of the backend, they are
+// registered on Registry and served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "library"
+
+// Registry is private to the backend rather than the global default
+// registry, so only collectors registered here are exposed.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Repository query latency by repository and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"repository", "method"})
+
+	UrlOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "url_operations_total",
+		Help:      "URL operations processed by operation and outcome.",
+	}, []string{"operation", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		QueryDuration,
+		UrlOperations,
+	)
+}
+
+// RegisterDB exposes the connection pool stats of db and the domain gauges
+// read from it.
+func RegisterDB(db *sqlx.DB) error {
+	if err := Registry.Register(collectors.NewDBStatsCollector(db.DB, "postgres")); err != nil {
+		return err
+	}
+
+	return Registry.Register(newDomainCollector(db))
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveQuery starts timing a repository query, call the returned function
+// once it is done.
+func ObserveQuery(repository, method string) func() {
+	start := time.Now()
+	return func() {
+		QueryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UrlOperation counts one processed URL.
+func UrlOperation(operation string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+
+	UrlOperations.WithLabelValues(operation, outcome).Inc()
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// Authenticate attaches the principal of the request to its context. Staff
+// users send an access JWT as a bearer token, integrations send an API key
+// either in X-API-Key or as a bearer token. Requests without credentials go
+// through anonymously, invalid credentials are rejected.
+func Authenticate(authService services.AuthServiceInterface, apiKeyService services.ApiKeyServiceInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := c.Request().Header.Get("X-API-Key")
+			isApiKey := token != ""
+			if !isApiKey {
+				header := c.Request().Header.Get(echo.HeaderAuthorization)
+				if header == "" {
+					return next(c)
+				}
+
+				scheme, bearer, ok := strings.Cut(header, " ")
+				if !ok || !strings.EqualFold(scheme, "Bearer") || bearer == "" {
+					return apperrors.Unauthorized("expected a bearer token")
+				}
+				token = bearer
+				isApiKey = services.IsApiKey(token)
+			}
+
+			var principal auth.Principal
+			var err error
+			if isApiKey {
+				principal, err = apiKeyService.Authenticate(c.Request().Context(), token)
+			} else {
+				principal, err = authService.Authenticate(c.Request().Context(), token)
+			}
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, services.ErrInvalidApiKey) {
+					return apperrors.Unauthorized(err.Error())
+				}
+
+				return apperrors.Internal(err, "unable to authenticate request")
+			}
+
+			ctx := auth.WithPrincipal(c.Request().Context(), principal)
+			ctx = utils.ContextWithLogger(ctx, utils.LoggerFromContext(ctx).WithField("user", principalField(principal)))
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// RequireAuth rejects anonymous requests, it must run after Authenticate.
+func RequireAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := auth.PrincipalFromContext(c.Request().Context()); !ok {
+				return apperrors.Unauthorized("authentication required")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequirePermission rejects requests whose principal lacks permission,
+// anonymous requests get 401 and authenticated ones 403.
+func RequirePermission(permission auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal, ok := auth.PrincipalFromContext(c.Request().Context())
+			if !ok {
+				return apperrors.Unauthorized("authentication required")
+			}
+
+			if err := auth.Require(principal, permission); err != nil {
+				return apperrors.Forbidden(err.Error())
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -1,23 +1,233 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/config"
 	"github.com/labstack/echo/v4"
 )
 
-func CORS() echo.MiddlewareFunc {
+// corsPolicy is a config.CORSPolicy ready to match requests against.
+type corsPolicy struct {
+	anyOrigin     bool
+	origins       map[string]bool
+	subdomains    []subdomainPattern
+	methods       map[string]bool
+	headers       map[string]bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// subdomainPattern matches the origins of "scheme://*.suffix", the "*"
+// standing for one or more subdomain labels.
+type subdomainPattern struct {
+	prefix string
+	suffix string
+}
+
+type corsRoute struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// CORS applies the CORS policy of the request path. Preflights from an
+// origin, method or header the policy doesn't allow are rejected with 403,
+// other requests from such origins go through without CORS headers so the
+// browser keeps their response from the calling script.
+func CORS(cfg config.CORSConfig) (echo.MiddlewareFunc, error) {
+	base, err := newCORSPolicy(cfg.CORSPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("cors: %w", err)
+	}
+
+	routes := make([]corsRoute, 0, len(cfg.Routes))
+	for prefix, override := range cfg.Routes {
+		policy, err := newCORSPolicy(mergeCORSPolicy(cfg.CORSPolicy, override))
+		if err != nil {
+			return nil, fmt.Errorf("cors route %s: %w", prefix, err)
+		}
+		routes = append(routes, corsRoute{prefix: prefix, policy: policy})
+	}
+	// longest prefix first
+	sort.Slice(routes, func(i, j int) bool { return len(routes[i].prefix) > len(routes[j].prefix) })
+
+	policyFor := func(path string) *corsPolicy {
+		for _, route := range routes {
+			if strings.HasPrefix(path, route.prefix) {
+				return route.policy
+			}
+		}
+		return base
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			c.Response().Header().Set("Access-Control-Allow-Origin", "*")
-			c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Response().Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+			req := c.Request()
+			header := c.Response().Header()
 
-			if c.Request().Method == "OPTIONS" {
-				return c.NoContent(http.StatusOK)
+			// the answer depends on the origin, caches must keep them apart
+			header.Add(echo.HeaderVary, echo.HeaderOrigin)
+
+			origin := req.Header.Get(echo.HeaderOrigin)
+			preflight := req.Method == http.MethodOptions && req.Header.Get(echo.HeaderAccessControlRequestMethod) != ""
+			if origin == "" {
+				return next(c)
+			}
+
+			policy := policyFor(req.URL.Path)
+			if !policy.allowsOrigin(origin) {
+				if preflight {
+					return apperrors.Forbidden(fmt.Sprintf("origin %s is not allowed", origin))
+				}
+				return next(c)
+			}
+
+			if preflight {
+				header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+				header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+
+				method := req.Header.Get(echo.HeaderAccessControlRequestMethod)
+				if !policy.methods[strings.ToUpper(method)] {
+					return apperrors.Forbidden(fmt.Sprintf("method %s is not allowed", method))
+				}
+				for _, name := range strings.Split(req.Header.Get(echo.HeaderAccessControlRequestHeaders), ",") {
+					name = strings.TrimSpace(name)
+					if name != "" && !policy.headers[strings.ToLower(name)] {
+						return apperrors.Forbidden(fmt.Sprintf("header %s is not allowed", name))
+					}
+				}
+
+				policy.setOrigin(header, origin)
+				header.Set(echo.HeaderAccessControlAllowMethods, policy.allowMethods)
+				if policy.allowHeaders != "" {
+					header.Set(echo.HeaderAccessControlAllowHeaders, policy.allowHeaders)
+				}
+				if policy.maxAge != "" {
+					header.Set(echo.HeaderAccessControlMaxAge, policy.maxAge)
+				}
+				return c.NoContent(http.StatusNoContent)
 			}
 
+			policy.setOrigin(header, origin)
+			if policy.exposeHeaders != "" {
+				header.Set(echo.HeaderAccessControlExposeHeaders, policy.exposeHeaders)
+			}
 			return next(c)
 		}
+	}, nil
+}
+
+func newCORSPolicy(cfg config.CORSPolicy) (*corsPolicy, error) {
+	policy := &corsPolicy{
+		origins:       make(map[string]bool),
+		methods:       make(map[string]bool),
+		headers:       make(map[string]bool),
+		allowMethods:  strings.Join(cfg.AllowMethods, ", "),
+		allowHeaders:  strings.Join(cfg.AllowHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposeHeaders, ", "),
+		credentials:   cfg.AllowCredentials,
+	}
+	if cfg.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	for _, origin := range cfg.AllowOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+		}
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+
+		if rest, ok := strings.CutPrefix(origin, u.Scheme+"://*."); ok {
+			policy.subdomains = append(policy.subdomains, subdomainPattern{prefix: u.Scheme + "://", suffix: "." + rest})
+			continue
+		}
+		if strings.Contains(origin, "*") {
+			return nil, fmt.Errorf("invalid origin %q, a wildcard is only allowed as the first label", origin)
+		}
+		policy.origins[origin] = true
+	}
+	if policy.anyOrigin && policy.credentials {
+		return nil, fmt.Errorf(`credentials can't be allowed with "*" as origin`)
+	}
+
+	for _, method := range cfg.AllowMethods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, name := range cfg.AllowHeaders {
+		policy.headers[strings.ToLower(name)] = true
+	}
+
+	return policy, nil
+}
+
+// mergeCORSPolicy fills the settings a route override leaves empty from
+// the main policy, except credentials which an override has to allow
+// itself.
+func mergeCORSPolicy(base, override config.CORSPolicy) config.CORSPolicy {
+	if override.AllowOrigins == nil {
+		override.AllowOrigins = base.AllowOrigins
+	}
+	if override.AllowMethods == nil {
+		override.AllowMethods = base.AllowMethods
+	}
+	if override.AllowHeaders == nil {
+		override.AllowHeaders = base.AllowHeaders
+	}
+	if override.ExposeHeaders == nil {
+		override.ExposeHeaders = base.ExposeHeaders
+	}
+	if override.MaxAge == 0 {
+		override.MaxAge = base.MaxAge
+	}
+	return override
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.subdomains {
+		if len(origin) <= len(pattern.prefix)+len(pattern.suffix) ||
+			!strings.HasPrefix(origin, pattern.prefix) || !strings.HasSuffix(origin, pattern.suffix) {
+			continue
+		}
+		label := origin[len(pattern.prefix) : len(origin)-len(pattern.suffix)]
+		if !strings.ContainsAny(label, ":/@") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *corsPolicy) setOrigin(header http.Header, origin string) {
+	if p.anyOrigin {
+		header.Set(echo.HeaderAccessControlAllowOrigin, "*")
+		return
+	}
+
+	header.Set(echo.HeaderAccessControlAllowOrigin, origin)
+	if p.credentials {
+		header.Set(echo.HeaderAccessControlAllowCredentials, "true")
 	}
 }
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/labstack/echo/v4"
+)
+
+func newTestCORSServer(t *testing.T, cfg config.CORSConfig) *echo.Echo {
+	t.Helper()
+
+	cors, err := CORS(cfg)
+	if err != nil {
+		t.Fatalf("CORS failed: %v", err)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
+	e.Use(cors)
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, "ok") }
+	for _, path := range []string{"/books", "/s/:code", "/s/:code/stats", "/public/feed"} {
+		e.GET(path, ok)
+		e.POST(path, ok)
+	}
+	return e
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{
+			AllowOrigins:     []string{"https://Example.com", "https://*.example.com", "http://localhost:3000"},
+			AllowMethods:     []string{"GET", "POST"},
+			AllowHeaders:     []string{"Authorization", "Content-Type"},
+			ExposeHeaders:    []string{"X-Request-Id"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Routes: map[string]config.CORSPolicy{
+			// only the origins change, the rest comes from the main policy
+			"/s/":      {AllowOrigins: []string{"https://share.example.org"}},
+			"/s/a/":    {AllowOrigins: []string{"*"}, AllowMethods: []string{"GET"}},
+			"/public/": {AllowOrigins: []string{"*"}, AllowHeaders: []string{}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		wantMethod  string
+		wantHeaders string
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   bool
+	}{
+		{name: "no origin", path: "/books", wantStatus: http.StatusOK},
+		{name: "exact origin", path: "/books", origin: "https://example.com", wantStatus: http.StatusOK, wantOrigin: "https://example.com", wantCreds: true},
+		{name: "origin case", path: "/books", origin: "https://EXAMPLE.com", wantStatus: http.StatusOK, wantOrigin: "https://EXAMPLE.com", wantCreds: true},
+		{name: "origin with port", path: "/books", origin: "http://localhost:3000", wantStatus: http.StatusOK, wantOrigin: "http://localhost:3000", wantCreds: true},
+		{name: "other port", path: "/books", origin: "http://localhost:3001", wantStatus: http.StatusOK},
+		{name: "other scheme", path: "/books", origin: "http://example.com", wantStatus: http.StatusOK},
+		{name: "subdomain", path: "/books", origin: "https://app.example.com", wantStatus: http.StatusOK, wantOrigin: "https://app.example.com", wantCreds: true},
+		{name: "nested subdomain", path: "/books", origin: "https://a.b.example.com", wantStatus: http.StatusOK, wantOrigin: "https://a.b.example.com", wantCreds: true},
+		{name: "lookalike suffix", path: "/books", origin: "https://evilexample.com", wantStatus: http.StatusOK},
+		{name: "lookalike subdomain of another site", path: "/books", origin: "https://example.com.evil.com", wantStatus: http.StatusOK},
+		{name: "subdomain named like another site", path: "/books", origin: "https://evil.com.example.com", wantStatus: http.StatusOK, wantOrigin: "https://evil.com.example.com", wantCreds: true},
+		{name: "userinfo smuggled", path: "/books", origin: "https://evil.com@x.example.com", wantStatus: http.StatusOK},
+		{name: "port smuggled", path: "/books", origin: "https://evil.com:443.example.com", wantStatus: http.StatusOK},
+		{name: "wildcard needs a label", path: "/books", origin: "https://.example.com", wantStatus: http.StatusOK},
+
+		{name: "preflight", method: http.MethodOptions, path: "/books", origin: "https://example.com", wantMethod: "post", wantHeaders: "content-type, Authorization", wantStatus: http.StatusNoContent, wantOrigin: "https://example.com", wantCreds: true},
+		{name: "preflight origin denied", method: http.MethodOptions, path: "/books", origin: "https://evil.com", wantMethod: "GET", wantStatus: http.StatusForbidden},
+		{name: "preflight method denied", method: http.MethodOptions, path: "/books", origin: "https://example.com", wantMethod: "DELETE", wantStatus: http.StatusForbidden},
+		{name: "preflight header denied", method: http.MethodOptions, path: "/books", origin: "https://example.com", wantMethod: "GET", wantHeaders: "Content-Type, X-Api-Key", wantStatus: http.StatusForbidden},
+
+		{name: "route origins replace the main ones", path: "/s/abc", origin: "https://example.com", wantStatus: http.StatusOK},
+		{name: "route origin", path: "/s/abc", origin: "https://share.example.org", wantStatus: http.StatusOK, wantOrigin: "https://share.example.org"},
+		{name: "route keeps the main methods", method: http.MethodOptions, path: "/s/abc", origin: "https://share.example.org", wantMethod: "POST", wantHeaders: "Authorization", wantStatus: http.StatusNoContent, wantOrigin: "https://share.example.org"},
+		{name: "longest route wins", method: http.MethodOptions, path: "/s/a/stats", origin: "https://anyone.net", wantMethod: "POST", wantStatus: http.StatusForbidden},
+		{name: "any origin", path: "/s/a/stats", origin: "https://anyone.net", wantStatus: http.StatusOK, wantOrigin: "*"},
+		{name: "empty route headers allow none", method: http.MethodOptions, path: "/public/feed", origin: "https://anyone.net", wantMethod: "GET", wantHeaders: "Authorization", wantStatus: http.StatusForbidden},
+	}
+
+	e := newTestCORSServer(t, cfg)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set(echo.HeaderOrigin, tt.origin)
+			}
+			if tt.wantMethod != "" {
+				req.Header.Set(echo.HeaderAccessControlRequestMethod, tt.wantMethod)
+			}
+			if tt.wantHeaders != "" {
+				req.Header.Set(echo.HeaderAccessControlRequestHeaders, tt.wantHeaders)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); got != tt.wantOrigin {
+				t.Errorf("allowed origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get(echo.HeaderAccessControlAllowCredentials) == "true"; got != tt.wantCreds {
+				t.Errorf("credentials allowed %v, want %v", got, tt.wantCreds)
+			}
+			if tt.wantOrigin != "" && rec.Header().Get(echo.HeaderVary) == "" {
+				t.Error("response doesn't vary by origin")
+			}
+		})
+	}
+}
+
+func TestCORSPreflightHeaders(t *testing.T) {
+	e := newTestCORSServer(t, config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{
+			AllowOrigins:  []string{"https://example.com"},
+			AllowMethods:  []string{"GET", "POST"},
+			AllowHeaders:  []string{"Authorization"},
+			ExposeHeaders: []string{"X-Request-Id"},
+			MaxAge:        10 * time.Minute,
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/books", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://example.com")
+	req.Header.Set(echo.HeaderAccessControlRequestMethod, "POST")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	want := map[string]string{
+		echo.HeaderAccessControlAllowMethods: "GET, POST",
+		echo.HeaderAccessControlAllowHeaders: "Authorization",
+		echo.HeaderAccessControlMaxAge:       "600",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/books", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://example.com")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if got := rec.Header().Get(echo.HeaderAccessControlExposeHeaders); got != "X-Request-Id" {
+		t.Errorf("exposed headers %q", got)
+	}
+}
+
+func TestCORSRejectsInvalidPolicies(t *testing.T) {
+	tests := map[string]config.CORSConfig{
+		"credentials with any origin": {CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"https://example.com", "*"}, AllowCredentials: true}},
+		"route credentials with inherited any origin": {
+			CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"*"}},
+			Routes:     map[string]config.CORSPolicy{"/s/": {AllowCredentials: true}},
+		},
+		"origin with a path":     {CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"https://example.com/app"}}},
+		"origin without scheme":  {CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"example.com"}}},
+		"wildcard in the middle": {CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"https://app.*.example.com"}}},
+		"invalid route origin":   {Routes: map[string]config.CORSPolicy{"/s/": {AllowOrigins: []string{"ftp://example.com"}}}},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := CORS(cfg); err == nil {
+				t.Error("CORS accepted the policy")
+			}
+		})
+	}
+
+	// the main policy's credentials aren't inherited, so a route may open up
+	if _, err := CORS(config.CORSConfig{
+		CORSPolicy: config.CORSPolicy{AllowOrigins: []string{"https://example.com"}, AllowCredentials: true},
+		Routes:     map[string]config.CORSPolicy{"/s/": {AllowOrigins: []string{"*"}}},
+	}); err != nil {
+		t.Errorf("CORS rejected a public route under a credentialed policy: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// queryCanceled is the postgres error code of a statement cancelled by
+// statement_timeout.
+const queryCanceled = "57014"
+
+// statusClientClosedRequest is the status nginx records for a request the
+// client gave up on, it is never sent.
+const statusClientClosedRequest = 499
+
+// echoKinds maps the statuses echo itself produces, for routing and body
+// limit errors, to problem kinds.
+var echoKinds = map[int]apperrors.Kind{
+	http.StatusBadRequest:            apperrors.KindBadRequest,
+	http.StatusUnauthorized:          apperrors.KindUnauthorized,
+	http.StatusForbidden:             apperrors.KindForbidden,
+	http.StatusNotFound:              apperrors.KindNotFound,
+	http.StatusMethodNotAllowed:      apperrors.KindMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: apperrors.KindPayloadTooLarge,
+	http.StatusUnsupportedMediaType:  apperrors.KindUnsupportedMediaType,
+	http.StatusTooManyRequests:       apperrors.KindTooManyRequests,
+	http.StatusServiceUnavailable:    apperrors.KindUnavailable,
+}
+
+// HTTPErrorHandler renders every error returned by a handler or middleware
+// as application/problem+json. Errors with no client-facing meaning are
+// logged and answered with a generic 500.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	logger := utils.LoggerFromContext(c.Request().Context())
+
+	// nobody is left to read the response, only the access log and the
+	// metrics see the status
+	if errors.Is(err, context.Canceled) && c.Request().Context().Err() != nil {
+		logger.WithError(err).Info("client closed request")
+		c.Response().Status = statusClientClosedRequest
+		return
+	}
+
+	appErr := toAppError(err)
+	if appErr.Kind == apperrors.KindInternal {
+		logger.WithError(err).Error("unhandled error")
+	}
+	if appErr.Kind == apperrors.KindTimeout {
+		logger.WithError(err).Warn("request timed out")
+	}
+	if appErr.Kind == apperrors.KindUnauthorized {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	}
+
+	problem := apperrors.NewProblem(appErr, c.Request().URL.Path, requestID(c))
+
+	var writeErr error
+	if c.Request().Method == http.MethodHead {
+		writeErr = c.NoContent(problem.Status)
+	} else {
+		// echo keeps a content type that is already set
+		c.Response().Header().Set(echo.HeaderContentType, apperrors.ContentType)
+		writeErr = c.JSON(problem.Status, problem)
+	}
+	if writeErr != nil {
+		logger.WithError(writeErr).Error("failed to write error response")
+	}
+}
+
+func toAppError(err error) *apperrors.Error {
+	if appErr := apperrors.From(err); appErr != nil {
+		if appErr.Kind == apperrors.KindInternal {
+			// handlers wrap the errors they don't expect, a denial from the
+			// service layer still deserves its status
+			switch {
+			case isTimeout(err):
+				return timeoutError(err)
+			case errors.Is(err, auth.ErrUnauthenticated):
+				return apperrors.Unauthorized(appErr.Unwrap().Error())
+			case errors.Is(err, auth.ErrForbidden):
+				return apperrors.Forbidden(appErr.Unwrap().Error())
+			}
+		}
+		return appErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		kind, ok := echoKinds[httpErr.Code]
+		if !ok {
+			return apperrors.Internal(err, "something went wrong")
+		}
+		detail, _ := httpErr.Message.(string)
+		return apperrors.New(kind, detail)
+	}
+
+	switch {
+	case isTimeout(err):
+		return timeoutError(err)
+	case errors.Is(err, sql.ErrNoRows):
+		return apperrors.NotFound("resource not found")
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return apperrors.Unauthorized(err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return apperrors.Forbidden(err.Error())
+	}
+
+	return apperrors.Internal(err, "something went wrong")
+}
+
+// isTimeout reports whether err comes from a request deadline or a query
+// cancelled by the database statement timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == queryCanceled
+}
+
+func timeoutError(err error) *apperrors.Error {
+	return apperrors.Timeout("the request took too long to complete").Wrap(err)
+}
+
+func requestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
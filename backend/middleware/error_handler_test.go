@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/labstack/echo/v4"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		cancel     bool
+		wantStatus int
+		wantBody   bool
+	}{
+		{name: "client gone", err: fmt.Errorf("query: %w", context.Canceled), cancel: true, wantStatus: statusClientClosedRequest},
+		{name: "canceled with the client still there", err: context.Canceled, wantStatus: http.StatusInternalServerError, wantBody: true},
+		{name: "deadline", err: apperrors.Internal(context.DeadlineExceeded, "unable to fetch books"), wantStatus: http.StatusGatewayTimeout, wantBody: true},
+		{name: "denied by a service", err: apperrors.Internal(auth.Require(auth.Principal{Role: auth.RoleViewer}, auth.PermBooksWrite), "unable to add book"), wantStatus: http.StatusForbidden, wantBody: true},
+		{name: "not found", err: apperrors.NotFound("book not found"), wantStatus: http.StatusNotFound, wantBody: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/books", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			HTTPErrorHandler(tt.err, c)
+
+			if c.Response().Status != tt.wantStatus {
+				t.Errorf("recorded status %d, want %d", c.Response().Status, tt.wantStatus)
+			}
+			if written := rec.Body.Len() > 0; written != tt.wantBody {
+				t.Errorf("body written = %v, want %v", written, tt.wantBody)
+			}
+		})
+	}
+}
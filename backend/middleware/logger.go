@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestLogger puts a logger carrying the request ID, method and route in
+// the request context and writes one access log entry per request once it
+// is answered. It must run after RequestID.
+func RequestLogger() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			entry := logrus.WithFields(logrus.Fields{
+				"request_id": c.Response().Header().Get(echo.HeaderXRequestID),
+				"method":     req.Method,
+				"route":      c.Path(),
+			})
+			c.SetRequest(req.WithContext(utils.ContextWithLogger(req.Context(), entry)))
+
+			if err := next(c); err != nil {
+				// render the error now so the access log sees its status
+				c.Error(err)
+			}
+
+			// Authenticate may have added the user to the logger
+			entry = utils.LoggerFromContext(c.Request().Context())
+			res := c.Response()
+			fields := logrus.Fields{
+				"path":       req.URL.Path,
+				"status":     res.Status,
+				"bytes_in":   req.ContentLength,
+				"bytes_out":  res.Size,
+				"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+				"remote_ip":  c.RealIP(),
+				"user_agent": req.UserAgent(),
+			}
+
+			switch {
+			case res.Status >= 500:
+				entry.WithFields(fields).Error("request failed")
+			case res.Status >= 400:
+				entry.WithFields(fields).Warn("request rejected")
+			default:
+				entry.WithFields(fields).Info("request handled")
+			}
+
+			return nil
+		}
+	}
+}
+
+// principalField identifies the principal in logs without exposing
+// credentials.
+func principalField(principal auth.Principal) string {
+	if principal.IsAPIKey() {
+		return fmt.Sprintf("key:%d", principal.APIKeyID)
+	}
+
+	return fmt.Sprintf("user:%d", principal.UserID)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/metrics"
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics counts requests and observes their latency, labelled by route
+// template rather than path to keep the number of series bounded.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			if err := next(c); err != nil {
+				// render the error now so its status is recorded
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(c.Response().Status)
+			method := c.Request().Method
+
+			metrics.HTTPRequests.WithLabelValues(method, route, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+			return nil
+		}
+	}
+}
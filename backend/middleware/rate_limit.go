@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/goesbams/mini-books-library/backend/apperrors"
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/ratelimit"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimit takes a token from the caller's bucket of group for every
+// request and answers 429 once it is empty. Callers are identified by API
+// key, then user, then IP, before Authenticate every caller is an IP. A
+// failing store lets requests through rather than taking the API down with
+// it.
+func RateLimit(store ratelimit.Store, group string, limit ratelimit.Limit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := group + ":" + clientKey(c)
+
+			res, err := store.Take(c.Request().Context(), key, limit)
+			if err != nil {
+				utils.LoggerFromContext(c.Request().Context()).WithError(err).WithField("bucket", key).Warn("rate limit check failed, letting the request through")
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset.Seconds())))
+
+			if !res.Allowed {
+				retryAfter := ceilSeconds(res.RetryAfter.Seconds())
+				header.Set(echo.HeaderRetryAfter, strconv.Itoa(retryAfter))
+				return apperrors.TooManyRequests(fmt.Sprintf("rate limit exceeded, retry in %ds", retryAfter))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func clientKey(c echo.Context) string {
+	if principal, ok := auth.PrincipalFromContext(c.Request().Context()); ok {
+		return principalField(principal)
+	}
+
+	return "ip:" + c.RealIP()
+}
+
+func ceilSeconds(seconds float64) int {
+	return int(math.Ceil(seconds))
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxRequestIDLength bounds the X-Request-ID accepted from callers, longer
+// or unprintable ones are replaced rather than copied into every log line.
+const maxRequestIDLength = 128
+
+// RequestID makes sure every request has an X-Request-ID, keeping the one
+// sent by the caller or a proxy and generating one otherwise. The ID is set
+// on the request for the handlers and echoed on the response.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+				c.Request().Header.Set(echo.HeaderXRequestID, id)
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
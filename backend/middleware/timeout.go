@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Timeout gives every request a deadline of timeout, queries and outgoing
+// calls made with the request context are cancelled once it passes and the
+// error handler answers 504. Routes in skip, such as batch streams, set their
+// own bounds. A zero timeout disables it.
+func Timeout(timeout time.Duration, skip ...string) echo.MiddlewareFunc {
+	skipped := make(map[string]bool, len(skip))
+	for _, route := range skip {
+		skipped[route] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if timeout <= 0 {
+			return next
+		}
+
+		return func(c echo.Context) error {
+			if skipped[c.Path()] {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
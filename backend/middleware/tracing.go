@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/goesbams/mini-books-library/backend/tracing"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace of
+// an incoming W3C traceparent header, and adds the trace ID to the request
+// logger. It must run after RequestLogger.
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracing.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", req.Method),
+					attribute.String("http.route", route),
+					attribute.String("url.path", req.URL.Path),
+					attribute.String("client.address", c.RealIP()),
+					attribute.String("request.id", c.Response().Header().Get(echo.HeaderXRequestID)),
+				),
+			)
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = utils.ContextWithLogger(ctx, utils.LoggerFromContext(ctx).WithField("trace_id", sc.TraceID().String()))
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			if err := next(c); err != nil {
+				// render the error inside the span so its status is recorded
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(
+				attribute.Int("http.response.status_code", status),
+				attribute.Int64("http.response.body.size", c.Response().Size),
+			)
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cover_checks;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE cover_checks (
+  book_id INTEGER PRIMARY KEY NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+  cover_image_url VARCHAR(255) NOT NULL,
+  status_code INTEGER NOT NULL DEFAULT 0,
+  healthy BOOLEAN NOT NULL DEFAULT FALSE,
+  error TEXT,
+  checked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  mirrored_at TIMESTAMP
+);
+
+CREATE INDEX idx_cover_checks_healthy ON cover_checks (healthy);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS short_link_clicks;
+DROP TABLE IF EXISTS short_links;
\ No newline at end of file
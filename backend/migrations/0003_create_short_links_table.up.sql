@@ -0,0 +1,18 @@
+CREATE TABLE short_links (
+  id SERIAL PRIMARY KEY NOT NULL,
+  code VARCHAR(64) NOT NULL UNIQUE,
+  target_url TEXT NOT NULL,
+  expires_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- clicks are aggregated per day, referrer host and user agent family so no
+-- raw IPs or user agents are ever stored
+CREATE TABLE short_link_clicks (
+  link_id INTEGER NOT NULL REFERENCES short_links(id) ON DELETE CASCADE,
+  day DATE NOT NULL,
+  referrer_host VARCHAR(255) NOT NULL DEFAULT '',
+  user_agent_family VARCHAR(32) NOT NULL DEFAULT '',
+  clicks INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (link_id, day, referrer_host, user_agent_family)
+);
@@ -0,0 +1,27 @@
+CREATE TABLE users (
+  id SERIAL PRIMARY KEY NOT NULL,
+  email VARCHAR(255) NOT NULL UNIQUE,
+  password_hash VARCHAR(255) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- only a SHA-256 of each refresh token is stored, tokens of one login share
+-- a family so reuse of a rotated token can revoke the whole chain
+CREATE TABLE refresh_tokens (
+  id SERIAL PRIMARY KEY NOT NULL,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  family VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family);
+
+-- access tokens revoked before their expiry, rows can go once expired
+CREATE TABLE revoked_access_tokens (
+  jti VARCHAR(64) PRIMARY KEY NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
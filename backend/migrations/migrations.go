@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations so the binary can apply them
+// without the files on disk.
+package migrations
+
+import "embed"
+
+// FS holds the NNNN_name.up.sql and NNNN_name.down.sql files.
+//
+//go:embed *.sql
+var FS embed.FS
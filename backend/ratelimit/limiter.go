@@ -0,0 +1,69 @@
+// Package ratelimit implements token bucket rate limiting on top of a
+// pluggable Store so limits can be shared between replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerPeriod builds a limit allowing requests per period, with bursts of up
+// to burst requests, burst defaults to requests.
+func PerPeriod(requests int, period time.Duration, burst int) Limit {
+	if burst <= 0 {
+		burst = requests
+	}
+
+	return Limit{Rate: float64(requests) / period.Seconds(), Burst: burst}
+}
+
+// Result is the outcome of taking one token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available, zero when allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps bucket state, Take must be atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// refill returns the tokens of a bucket after elapsed, capped at burst.
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// result describes a bucket left with tokens after a take.
+func result(allowed bool, tokens float64, limit Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+
+	return res
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
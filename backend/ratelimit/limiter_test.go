@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testStore runs the token bucket behaviour every Store must share, advance
+// moves the store's clock forward.
+func testStore(t *testing.T, store Store, advance func(time.Duration)) {
+	t.Helper()
+
+	ctx := context.Background()
+	limit := PerPeriod(2, time.Second, 3)
+
+	take := func(key string) Result {
+		t.Helper()
+		res, err := store.Take(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("Take(%s) failed: %v", key, err)
+		}
+		return res
+	}
+
+	for want := 2; want >= 0; want-- {
+		res := take("client")
+		if !res.Allowed || res.Remaining != want || res.Limit != 3 {
+			t.Fatalf("burst take = %+v, want allowed with %d remaining", res, want)
+		}
+	}
+
+	res := take("client")
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Errorf("take from an empty bucket = %+v, want denied, retry after 500ms and full in 1.5s", res)
+	}
+	if other := take("other"); !other.Allowed || other.Remaining != 2 {
+		t.Errorf("take from another bucket = %+v, want a bucket of its own", other)
+	}
+
+	advance(500 * time.Millisecond)
+	if res := take("client"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("take after the retry delay = %+v, want allowed", res)
+	}
+
+	advance(time.Hour)
+	if res := take("client"); !res.Allowed || res.Remaining != 2 || res.Reset != 500*time.Millisecond {
+		t.Errorf("take from a bucket idle for an hour = %+v, want it refilled up to the burst only", res)
+	}
+}
+
+func TestPerPeriod(t *testing.T) {
+	if limit := PerPeriod(60, time.Minute, 0); limit.Rate != 1 || limit.Burst != 60 {
+		t.Errorf("PerPeriod(60, 1m, 0) = %+v, want 1/s with bursts of 60", limit)
+	}
+	if limit := PerPeriod(10, time.Second, 2); limit.Rate != 10 || limit.Burst != 2 {
+		t.Errorf("PerPeriod(10, 1s, 2) = %+v, want 10/s with bursts of 2", limit)
+	}
+}
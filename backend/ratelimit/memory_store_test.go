@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestMemoryStore() (*MemoryStore, func(time.Duration)) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	return store, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, advance := newTestMemoryStore()
+	testStore(t, store, advance)
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	store, advance := newTestMemoryStore()
+	// a token takes 10s to come back
+	limit := PerPeriod(1, 10*time.Second, 10)
+
+	store.Take(context.Background(), "idle", limit)
+	advance(30 * time.Second)
+	for i := 0; i < 10; i++ {
+		store.Take(context.Background(), "busy", limit)
+	}
+
+	// the next sweep only forgets the bucket that refilled meanwhile
+	advance(sweepEvery - 30*time.Second)
+	store.Take(context.Background(), "new", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("full idle bucket kept after a sweep")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisStore runs the store against an in-process Redis with its own
+// clock, the Lua script is executed as a real server would.
+func newTestRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis, func(time.Duration)) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		server.SetTime(now)
+		server.FastForward(d)
+	}
+
+	return NewRedisStore(client, "test:"), server, advance
+}
+
+func TestRedisStore(t *testing.T) {
+	store, _, advance := newTestRedisStore(t)
+	testStore(t, store, advance)
+}
+
+func TestRedisStoreExpiresFullBuckets(t *testing.T) {
+	store, server, advance := newTestRedisStore(t)
+	limit := PerPeriod(2, time.Second, 4)
+
+	store.Take(context.Background(), "client", limit)
+	store.Take(context.Background(), "client", limit)
+	if ttl := server.TTL("test:client"); ttl != time.Second {
+		t.Errorf("bucket expires in %s, want the 1s it takes to refill", ttl)
+	}
+
+	advance(time.Second)
+	if server.Exists("test:client") {
+		t.Error("bucket kept once full")
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	store, server, _ := newTestRedisStore(t)
+	server.Close()
+
+	if _, err := store.Take(context.Background(), "client", PerPeriod(1, time.Second, 1)); err == nil {
+		t.Error("Take succeeded without a server")
+	}
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+// lastUsedResolution throttles last_used_at writes so a busy key doesn't
+// update its row on every request.
+const lastUsedResolution = time.Minute
+
+type ApiKeyRepositoryInterface interface {
+	CreateApiKey(ctx context.Context, db *sqlx.DB, key *entities.ApiKey) error
+	GetApiKeys(ctx context.Context, db *sqlx.DB) ([]entities.ApiKey, error)
+	GetApiKeyByHash(ctx context.Context, db *sqlx.DB, keyHash string) (entities.ApiKey, error)
+	RevokeApiKey(ctx context.Context, db *sqlx.DB, id int) error
+	TouchApiKey(ctx context.Context, db *sqlx.DB, id int, usedAt time.Time) error
+}
+
+type ApiKeyRepository struct{}
+
+func NewApiKeyRepository() ApiKeyRepositoryInterface {
+	return &ApiKeyRepository{}
+}
+
+func (r *ApiKeyRepository) CreateApiKey(ctx context.Context, db *sqlx.DB, key *entities.ApiKey) error {
+	query := `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES (:name, :prefix, :key_hash, :scopes, :created_by, :expires_at)
+		RETURNING id, created_at
+	`
+	ctx, done := observe(ctx, "api_key", "CreateApiKey", query)
+
+	rows, err := db.NamedQueryContext(ctx, query, key)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&key.ID, &key.CreatedAt); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *ApiKeyRepository) GetApiKeys(ctx context.Context, db *sqlx.DB) ([]entities.ApiKey, error) {
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, created_by, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		ORDER BY id
+	`
+	ctx, done := observe(ctx, "api_key", "GetApiKeys", query)
+
+	var keys []entities.ApiKey
+	err := db.SelectContext(ctx, &keys, query)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return []entities.ApiKey{}, nil
+	}
+
+	return keys, nil
+}
+
+func (r *ApiKeyRepository) GetApiKeyByHash(ctx context.Context, db *sqlx.DB, keyHash string) (entities.ApiKey, error) {
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, created_by, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE key_hash = $1
+	`
+	ctx, done := observe(ctx, "api_key", "GetApiKeyByHash", query)
+
+	var key entities.ApiKey
+	err := db.GetContext(ctx, &key, query, keyHash)
+	done(err)
+	if err != nil {
+		return entities.ApiKey{}, fmt.Errorf("database error: %w", err)
+	}
+
+	return key, nil
+}
+
+func (r *ApiKeyRepository) RevokeApiKey(ctx context.Context, db *sqlx.DB, id int) error {
+	query := `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`
+	ctx, done := observe(ctx, "api_key", "RevokeApiKey", query)
+
+	res, err := db.ExecContext(ctx, query, time.Now().UTC(), id)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *ApiKeyRepository) TouchApiKey(ctx context.Context, db *sqlx.DB, id int, usedAt time.Time) error {
+	query := `
+		UPDATE api_keys SET last_used_at = $1
+		WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)
+	`
+	ctx, done := observe(ctx, "api_key", "TouchApiKey", query)
+
+	_, err := db.ExecContext(ctx, query, usedAt.UTC(), id, usedAt.Add(-lastUsedResolution).UTC())
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -11,11 +12,11 @@ import (
 )
 
 type BookRepositoryInterface interface {
-	GetBooks(db *sqlx.DB) ([]entities.Book, error)
-	AddBook(db *sqlx.DB, book *entities.Book) error
-	GetBookById(db *sqlx.DB, id string) (entities.Book, error)
-	UpdateBook(db *sqlx.DB, id string, book *entities.Book) error
-	DeleteBook(db *sqlx.DB, id string) error
+	GetBooks(ctx context.Context, db *sqlx.DB) ([]entities.Book, error)
+	AddBook(ctx context.Context, db *sqlx.DB, book *entities.Book) error
+	GetBookById(ctx context.Context, db *sqlx.DB, id string) (entities.Book, error)
+	UpdateBook(ctx context.Context, db *sqlx.DB, id string, book *entities.Book) error
+	DeleteBook(ctx context.Context, db *sqlx.DB, id string) error
 }
 
 type BookRepository struct{}
@@ -24,9 +25,13 @@ func NewBookRepository() BookRepositoryInterface {
 	return &BookRepository{}
 }
 
-func (r *BookRepository) GetBooks(db *sqlx.DB) ([]entities.Book, error) {
+func (r *BookRepository) GetBooks(ctx context.Context, db *sqlx.DB) ([]entities.Book, error) {
+	query := "SELECT id, title, author, cover_image_url, description, publication_date, Isbn, number_of_pages FROM books"
+	ctx, done := observe(ctx, "book", "GetBooks", query)
+
 	var books []entities.Book
-	err := db.Select(&books, "SELECT id, title, author, cover_image_url, description, publication_date, Isbn, number_of_pages FROM books")
+	err := db.SelectContext(ctx, &books, query)
+	done(err)
 	if err != nil {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
@@ -38,12 +43,16 @@ func (r *BookRepository) GetBooks(db *sqlx.DB) ([]entities.Book, error) {
 	return books, nil
 }
 
-func (r *BookRepository) AddBook(db *sqlx.DB, book *entities.Book) error {
-	_, err := db.NamedExec(`
+func (r *BookRepository) AddBook(ctx context.Context, db *sqlx.DB, book *entities.Book) error {
+	query := `
     INSERT INTO books (
         title, author, cover_image_url, description, publication_date, number_of_pages, isbn
     ) VALUES (:title, :author, :cover_image_url, :description, :publication_date, :number_of_pages, :isbn)
-		`, book)
+		`
+	ctx, done := observe(ctx, "book", "AddBook", query)
+
+	_, err := db.NamedExecContext(ctx, query, book)
+	done(err)
 	if err != nil {
 		return fmt.Errorf("database error: %w", err)
 	}
@@ -51,13 +60,17 @@ func (r *BookRepository) AddBook(db *sqlx.DB, book *entities.Book) error {
 	return nil
 }
 
-func (r *BookRepository) GetBookById(db *sqlx.DB, id string) (entities.Book, error) {
-	var book entities.Book
-	err := db.Get(&book, `
+func (r *BookRepository) GetBookById(ctx context.Context, db *sqlx.DB, id string) (entities.Book, error) {
+	query := `
 		SELECT id, title, author, cover_image_url, description, publication_date, number_of_pages, isbn
 		FROM books
 		WHERE id = $1
-	`, id)
+	`
+	ctx, done := observe(ctx, "book", "GetBookById", query)
+
+	var book entities.Book
+	err := db.GetContext(ctx, &book, query, id)
+	done(err)
 	if err != nil {
 		return entities.Book{}, fmt.Errorf("database error: %w", err)
 	}
@@ -65,7 +78,7 @@ func (r *BookRepository) GetBookById(db *sqlx.DB, id string) (entities.Book, err
 	return book, nil
 }
 
-func (r *BookRepository) UpdateBook(db *sqlx.DB, id string, book *entities.Book) error {
+func (r *BookRepository) UpdateBook(ctx context.Context, db *sqlx.DB, id string, book *entities.Book) error {
 	book.ID, _ = strconv.Atoi(id)
 
 	updates := []string{}
@@ -109,7 +122,10 @@ func (r *BookRepository) UpdateBook(db *sqlx.DB, id string, book *entities.Book)
 
 	query := fmt.Sprintf("UPDATE books SET %s WHERE id = :id", strings.Join(updates, ", "))
 
-	res, err := db.NamedExec(query, args)
+	ctx, done := observe(ctx, "book", "UpdateBook", query)
+
+	res, err := db.NamedExecContext(ctx, query, args)
+	done(err)
 	if err != nil {
 		return fmt.Errorf("database error: %w", err)
 	}
@@ -122,8 +138,12 @@ func (r *BookRepository) UpdateBook(db *sqlx.DB, id string, book *entities.Book)
 	return nil
 }
 
-func (r *BookRepository) DeleteBook(db *sqlx.DB, id string) error {
-	_, err := db.Exec("DELETE FROM books WHERE id = $1", id)
+func (r *BookRepository) DeleteBook(ctx context.Context, db *sqlx.DB, id string) error {
+	query := "DELETE FROM books WHERE id = $1"
+	ctx, done := observe(ctx, "book", "DeleteBook", query)
+
+	_, err := db.ExecContext(ctx, query, id)
+	done(err)
 	if err != nil {
 		return fmt.Errorf("database error: %w", err)
 	}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type CoverCheckRepositoryInterface interface {
+	SaveCoverCheck(ctx context.Context, db *sqlx.DB, check *entities.CoverCheck) error
+	MarkCoverMirrored(ctx context.Context, db *sqlx.DB, bookID int) error
+	GetBrokenCovers(ctx context.Context, db *sqlx.DB) ([]entities.CoverCheck, error)
+}
+
+type CoverCheckRepository struct{}
+
+func NewCoverCheckRepository() CoverCheckRepositoryInterface {
+	return &CoverCheckRepository{}
+}
+
+// SaveCoverCheck records the latest check result for a book and loads the
+// mirror timestamp back into check. A changed cover URL clears the mirror.
+func (r *CoverCheckRepository) SaveCoverCheck(ctx context.Context, db *sqlx.DB, check *entities.CoverCheck) error {
+	query := `
+		INSERT INTO cover_checks (book_id, cover_image_url, status_code, healthy, error, checked_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		ON CONFLICT (book_id) DO UPDATE SET
+			cover_image_url = EXCLUDED.cover_image_url,
+			status_code = EXCLUDED.status_code,
+			healthy = EXCLUDED.healthy,
+			error = EXCLUDED.error,
+			checked_at = EXCLUDED.checked_at,
+			mirrored_at = CASE
+				WHEN cover_checks.cover_image_url = EXCLUDED.cover_image_url THEN cover_checks.mirrored_at
+				ELSE NULL
+			END
+		RETURNING mirrored_at
+	`
+	ctx, done := observe(ctx, "cover_check", "SaveCoverCheck", query)
+
+	var mirroredAt *time.Time
+	err := db.GetContext(ctx, &mirroredAt, query, check.BookID, check.CoverImageUrl, check.StatusCode, check.Healthy, check.Error, check.CheckedAt)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	check.MirroredAt = mirroredAt
+	return nil
+}
+
+func (r *CoverCheckRepository) MarkCoverMirrored(ctx context.Context, db *sqlx.DB, bookID int) error {
+	query := "UPDATE cover_checks SET mirrored_at = CURRENT_TIMESTAMP WHERE book_id = $1"
+	ctx, done := observe(ctx, "cover_check", "MarkCoverMirrored", query)
+
+	_, err := db.ExecContext(ctx, query, bookID)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *CoverCheckRepository) GetBrokenCovers(ctx context.Context, db *sqlx.DB) ([]entities.CoverCheck, error) {
+	query := `
+		SELECT c.book_id, b.title, c.cover_image_url, c.status_code, c.healthy,
+			COALESCE(c.error, '') AS error, c.checked_at, c.mirrored_at
+		FROM cover_checks c
+		JOIN books b ON b.id = c.book_id
+		WHERE c.healthy = FALSE
+		ORDER BY c.checked_at DESC
+	`
+	ctx, done := observe(ctx, "cover_check", "GetBrokenCovers", query)
+
+	var checks []entities.CoverCheck
+	err := db.SelectContext(ctx, &checks, query)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if len(checks) == 0 {
+		return []entities.CoverCheck{}, nil
+	}
+
+	return checks, nil
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateCode = errors.New("short link code already exists")
+
+// uniqueViolation is the postgres error code for unique constraint failures.
+const uniqueViolation = "23505"
+
+type LinkRepositoryInterface interface {
+	CreateLink(ctx context.Context, db *sqlx.DB, link *entities.ShortLink) error
+	GetLinkByCode(ctx context.Context, db *sqlx.DB, code string) (entities.ShortLink, error)
+	RecordClick(ctx context.Context, db *sqlx.DB, linkID int, day time.Time, referrerHost, userAgentFamily string) error
+	GetLinkClicks(ctx context.Context, db *sqlx.DB, linkID int) ([]entities.LinkClickStat, error)
+}
+
+type LinkRepository struct{}
+
+func NewLinkRepository() LinkRepositoryInterface {
+	return &LinkRepository{}
+}
+
+func (r *LinkRepository) CreateLink(ctx context.Context, db *sqlx.DB, link *entities.ShortLink) error {
+	query := `
+		INSERT INTO short_links (code, target_url, expires_at)
+		VALUES (:code, :target_url, :expires_at)
+		RETURNING id, created_at
+	`
+	ctx, done := observe(ctx, "link", "CreateLink", query)
+
+	rows, err := db.NamedQueryContext(ctx, query, link)
+	done(err)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrDuplicateCode
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&link.ID, &link.CreatedAt); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *LinkRepository) GetLinkByCode(ctx context.Context, db *sqlx.DB, code string) (entities.ShortLink, error) {
+	query := `
+		SELECT id, code, target_url, expires_at, created_at
+		FROM short_links
+		WHERE code = $1
+	`
+	ctx, done := observe(ctx, "link", "GetLinkByCode", query)
+
+	var link entities.ShortLink
+	err := db.GetContext(ctx, &link, query, code)
+	done(err)
+	if err != nil {
+		return entities.ShortLink{}, fmt.Errorf("database error: %w", err)
+	}
+
+	return link, nil
+}
+
+func (r *LinkRepository) RecordClick(ctx context.Context, db *sqlx.DB, linkID int, day time.Time, referrerHost, userAgentFamily string) error {
+	query := `
+		INSERT INTO short_link_clicks (link_id, day, referrer_host, user_agent_family, clicks)
+		VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (link_id, day, referrer_host, user_agent_family)
+		DO UPDATE SET clicks = short_link_clicks.clicks + 1
+	`
+	ctx, done := observe(ctx, "link", "RecordClick", query)
+
+	_, err := db.ExecContext(ctx, query, linkID, day.Format("2006-01-02"), referrerHost, userAgentFamily)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *LinkRepository) GetLinkClicks(ctx context.Context, db *sqlx.DB, linkID int) ([]entities.LinkClickStat, error) {
+	query := `
+		SELECT to_char(day, 'YYYY-MM-DD') AS day, referrer_host, user_agent_family, clicks
+		FROM short_link_clicks
+		WHERE link_id = $1
+		ORDER BY day DESC, clicks DESC
+	`
+	ctx, done := observe(ctx, "link", "GetLinkClicks", query)
+
+	var stats []entities.LinkClickStat
+	err := db.SelectContext(ctx, &stats, query, linkID)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if len(stats) == 0 {
+		return []entities.LinkClickStat{}, nil
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/goesbams/mini-books-library/backend/metrics"
+	"github.com/goesbams/mini-books-library/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// observe times a repository query and traces it as a child span of ctx
+// carrying the sanitized SQL. Call the returned function with the query's
+// error once it is done, sql.ErrNoRows is an answer rather than a failure.
+func observe(ctx context.Context, repository, method, query string) (context.Context, func(error)) {
+	done := metrics.ObserveQuery(repository, method)
+	ctx, span := tracing.Start(ctx, repository+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", method),
+			attribute.String("db.query.text", tracing.SanitizeSQL(query)),
+		),
+	)
+
+	return ctx, func(err error) {
+		done()
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		tracing.End(span, err)
+	}
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/jmoiron/sqlx"
+)
+
+type TokenRepositoryInterface interface {
+	CreateRefreshToken(ctx context.Context, db *sqlx.DB, token *entities.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, db *sqlx.DB, tokenHash string) (entities.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, db *sqlx.DB, id int) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, db *sqlx.DB, family string) error
+	RevokeAccessToken(ctx context.Context, db *sqlx.DB, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, db *sqlx.DB, jti string) (bool, error)
+}
+
+type TokenRepository struct{}
+
+func NewTokenRepository() TokenRepositoryInterface {
+	return &TokenRepository{}
+}
+
+func (r *TokenRepository) CreateRefreshToken(ctx context.Context, db *sqlx.DB, token *entities.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, family, expires_at)
+		VALUES (:user_id, :token_hash, :family, :expires_at)
+		RETURNING id
+	`
+	ctx, done := observe(ctx, "token", "CreateRefreshToken", query)
+
+	rows, err := db.NamedQueryContext(ctx, query, token)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&token.ID); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *TokenRepository) GetRefreshTokenByHash(ctx context.Context, db *sqlx.DB, tokenHash string) (entities.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, token_hash, family, expires_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+	ctx, done := observe(ctx, "token", "GetRefreshTokenByHash", query)
+
+	var token entities.RefreshToken
+	err := db.GetContext(ctx, &token, query, tokenHash)
+	done(err)
+	if err != nil {
+		return entities.RefreshToken{}, fmt.Errorf("database error: %w", err)
+	}
+
+	return token, nil
+}
+
+// RevokeRefreshToken revokes a token and reports whether this call did it,
+// false means it was already revoked, possibly by a concurrent refresh.
+func (r *TokenRepository) RevokeRefreshToken(ctx context.Context, db *sqlx.DB, id int) (bool, error) {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+	ctx, done := observe(ctx, "token", "RevokeRefreshToken", query)
+
+	result, err := db.ExecContext(ctx, query, id)
+	done(err)
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+func (r *TokenRepository) RevokeRefreshTokenFamily(ctx context.Context, db *sqlx.DB, family string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family = $1 AND revoked_at IS NULL
+	`
+	ctx, done := observe(ctx, "token", "RevokeRefreshTokenFamily", query)
+
+	_, err := db.ExecContext(ctx, query, family)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAccessToken denies an access token until it expires, expired rows
+// are pruned on the way.
+func (r *TokenRepository) RevokeAccessToken(ctx context.Context, db *sqlx.DB, jti string, expiresAt time.Time) error {
+	pruneQuery := `DELETE FROM revoked_access_tokens WHERE expires_at < $1`
+	pruneCtx, pruneDone := observe(ctx, "token", "PruneRevokedAccessTokens", pruneQuery)
+
+	_, err := db.ExecContext(pruneCtx, pruneQuery, time.Now().UTC())
+	pruneDone(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	query := `
+		INSERT INTO revoked_access_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	ctx, done := observe(ctx, "token", "RevokeAccessToken", query)
+
+	_, err = db.ExecContext(ctx, query, jti, expiresAt.UTC())
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return nil
+}
+
+func (r *TokenRepository) IsAccessTokenRevoked(ctx context.Context, db *sqlx.DB, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1)`
+	ctx, done := observe(ctx, "token", "IsAccessTokenRevoked", query)
+
+	var revoked bool
+	err := db.GetContext(ctx, &revoked, query, jti)
+	done(err)
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	return revoked, nil
+}
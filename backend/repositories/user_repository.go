@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateEmail = errors.New("a user with this email already exists")
+
+type UserRepositoryInterface interface {
+	CreateUser(ctx context.Context, db *sqlx.DB, user *entities.User) error
+	GetUserByEmail(ctx context.Context, db *sqlx.DB, email string) (entities.User, error)
+	GetUserById(ctx context.Context, db *sqlx.DB, id int) (entities.User, error)
+	GetUsers(ctx context.Context, db *sqlx.DB) ([]entities.User, error)
+	UpdateUserRole(ctx context.Context, db *sqlx.DB, id int, role string) error
+}
+
+type UserRepository struct{}
+
+func NewUserRepository() UserRepositoryInterface {
+	return &UserRepository{}
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, db *sqlx.DB, user *entities.User) error {
+	query := `
+		INSERT INTO users (email, password_hash, role)
+		VALUES (:email, :password_hash, :role)
+		RETURNING id, created_at
+	`
+	ctx, done := observe(ctx, "user", "CreateUser", query)
+
+	rows, err := db.NamedQueryContext(ctx, query, user)
+	done(err)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return ErrDuplicateEmail
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.Scan(&user.ID, &user.CreatedAt); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *UserRepository) GetUserByEmail(ctx context.Context, db *sqlx.DB, email string) (entities.User, error) {
+	query := `
+		SELECT id, email, password_hash, role, created_at
+		FROM users
+		WHERE email = $1
+	`
+	ctx, done := observe(ctx, "user", "GetUserByEmail", query)
+
+	var user entities.User
+	err := db.GetContext(ctx, &user, query, email)
+	done(err)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("database error: %w", err)
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetUserById(ctx context.Context, db *sqlx.DB, id int) (entities.User, error) {
+	query := `
+		SELECT id, email, password_hash, role, created_at
+		FROM users
+		WHERE id = $1
+	`
+	ctx, done := observe(ctx, "user", "GetUserById", query)
+
+	var user entities.User
+	err := db.GetContext(ctx, &user, query, id)
+	done(err)
+	if err != nil {
+		return entities.User{}, fmt.Errorf("database error: %w", err)
+	}
+
+	return user, nil
+}
+
+func (r *UserRepository) GetUsers(ctx context.Context, db *sqlx.DB) ([]entities.User, error) {
+	query := `
+		SELECT id, email, password_hash, role, created_at
+		FROM users
+		ORDER BY id
+	`
+	ctx, done := observe(ctx, "user", "GetUsers", query)
+
+	var users []entities.User
+	err := db.SelectContext(ctx, &users, query)
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if len(users) == 0 {
+		return []entities.User{}, nil
+	}
+
+	return users, nil
+}
+
+func (r *UserRepository) UpdateUserRole(ctx context.Context, db *sqlx.DB, id int, role string) error {
+	query := `
+		UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`
+	ctx, done := observe(ctx, "user", "UpdateUserRole", query)
+
+	res, err := db.ExecContext(ctx, query, role, id)
+	done(err)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeApiKeyRepo struct {
+	keys      []entities.ApiKey
+	touched   map[int]time.Time
+	touchFail bool
+	lookups   int
+}
+
+func newFakeApiKeyRepo() *fakeApiKeyRepo {
+	return &fakeApiKeyRepo{touched: make(map[int]time.Time)}
+}
+
+func (r *fakeApiKeyRepo) CreateApiKey(ctx context.Context, db *sqlx.DB, key *entities.ApiKey) error {
+	key.ID = len(r.keys) + 1
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *fakeApiKeyRepo) GetApiKeys(ctx context.Context, db *sqlx.DB) ([]entities.ApiKey, error) {
+	return r.keys, nil
+}
+
+func (r *fakeApiKeyRepo) GetApiKeyByHash(ctx context.Context, db *sqlx.DB, keyHash string) (entities.ApiKey, error) {
+	r.lookups++
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
+	}
+	return entities.ApiKey{}, sql.ErrNoRows
+}
+
+func (r *fakeApiKeyRepo) RevokeApiKey(ctx context.Context, db *sqlx.DB, id int) error {
+	now := time.Now()
+	r.keys[id-1].RevokedAt = &now
+	return nil
+}
+
+func (r *fakeApiKeyRepo) TouchApiKey(ctx context.Context, db *sqlx.DB, id int, usedAt time.Time) error {
+	if r.touchFail {
+		return errors.New("database unavailable")
+	}
+	r.touched[id] = usedAt
+	return nil
+}
+
+func TestCreateApiKeyFormat(t *testing.T) {
+	repo := newFakeApiKeyRepo()
+	service := NewApiKeyService(repo, nil)
+	admin := auth.Principal{UserID: 1, Role: auth.RoleAdmin}
+
+	// ids are random, enough keys make one with a "_" in its raw id likely
+	for i := 0; i < 50; i++ {
+		key, err := service.CreateApiKey(context.Background(), admin, &entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"urls:process"}})
+		if err != nil {
+			t.Fatalf("CreateApiKey failed: %v", err)
+		}
+
+		rest, ok := strings.CutPrefix(key.Key, ApiKeyPrefix)
+		if !ok || !IsApiKey(key.Key) {
+			t.Fatalf("key %q lacks the %s prefix", key.Key, ApiKeyPrefix)
+		}
+		id, secret, _ := strings.Cut(rest, "_")
+		if key.Prefix != ApiKeyPrefix+id || len(id) != 8 || len(secret) != 43 {
+			t.Fatalf("key %q splits into id %q and secret %q, stored prefix %q", key.Key, id, secret, key.Prefix)
+		}
+
+		stored := repo.keys[len(repo.keys)-1]
+		if stored.Key != "" || stored.KeyHash != auth.HashToken(key.Key) {
+			t.Fatalf("stored %+v, want only the hash of the key", stored)
+		}
+		if stored.CreatedBy == nil || *stored.CreatedBy != 1 {
+			t.Errorf("created by %v, want 1", stored.CreatedBy)
+		}
+	}
+
+	if IsApiKey("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("IsApiKey accepted a JWT")
+	}
+}
+
+func TestCreateApiKeyScopes(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		creator auth.Principal
+		req     entities.CreateApiKeyRequest
+		wantErr error
+	}{
+		{name: "admin grants any scope", creator: auth.Principal{UserID: 1, Role: auth.RoleAdmin}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"books:delete", "urls:process"}}},
+		{name: "librarian grants own scope", creator: auth.Principal{UserID: 2, Role: auth.RoleLibrarian}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"books:write"}}},
+		{name: "librarian escalates", creator: auth.Principal{UserID: 2, Role: auth.RoleLibrarian}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"books:write", "books:delete"}}, wantErr: auth.ErrForbidden},
+		{name: "key escalates", creator: auth.Principal{APIKeyID: 3, Scopes: []auth.Permission{auth.PermUrlsProcess}}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"books:write"}}, wantErr: auth.ErrForbidden},
+		{name: "unknown scope", creator: auth.Principal{UserID: 1, Role: auth.RoleAdmin}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"api-keys:manage"}}, wantErr: utils.ValidationError{}},
+		{name: "expired already", creator: auth.Principal{UserID: 1, Role: auth.RoleAdmin}, req: entities.CreateApiKeyRequest{Name: "ci", Scopes: []string{"urls:process"}, ExpiresAt: &past}, wantErr: utils.ValidationError{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeApiKeyRepo()
+
+			_, err := NewApiKeyService(repo, nil).CreateApiKey(context.Background(), tt.creator, &tt.req)
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("CreateApiKey failed: %v", err)
+				}
+			case utils.ValidationError:
+				if !errors.As(err, &want) {
+					t.Fatalf("err = %v, want a validation error", err)
+				}
+			default:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if created := len(repo.keys) == 1; created != (tt.wantErr == nil) {
+				t.Errorf("key stored %v, want %v", created, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestApiKeyAuthenticate(t *testing.T) {
+	repo := newFakeApiKeyRepo()
+	service := NewApiKeyService(repo, nil)
+	admin := auth.Principal{UserID: 1, Role: auth.RoleAdmin}
+	create := func(scopes ...string) entities.ApiKey {
+		key, err := service.CreateApiKey(context.Background(), admin, &entities.CreateApiKeyRequest{Name: "ci", Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	valid := create("urls:process", "books:write")
+	revoked := create("urls:process")
+	service.RevokeApiKey(context.Background(), revoked.ID)
+	expired := create("urls:process")
+	past := time.Now().Add(-time.Minute)
+	repo.keys[expired.ID-1].ExpiresAt = &past
+	legacy := create("urls:process")
+	// a scope dropped from the code since the key was made
+	repo.keys[legacy.ID-1].Scopes = append(repo.keys[legacy.ID-1].Scopes, "books:archive")
+
+	principal, err := service.Authenticate(context.Background(), valid.Key)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if principal.APIKeyID != valid.ID || principal.UserID != 0 || len(principal.Scopes) != 2 {
+		t.Errorf("principal = %+v", principal)
+	}
+	if auth.Require(principal, auth.PermBooksWrite) != nil || auth.Require(principal, auth.PermBooksDelete) == nil {
+		t.Errorf("principal scopes %v don't match the key", principal.Scopes)
+	}
+	if _, ok := repo.touched[valid.ID]; !ok {
+		t.Error("use of the key wasn't recorded")
+	}
+
+	principal, err = service.Authenticate(context.Background(), legacy.Key)
+	if err != nil || len(principal.Scopes) != 1 || principal.Scopes[0] != auth.PermUrlsProcess {
+		t.Errorf("legacy key principal = %+v, %v, want only urls:process", principal, err)
+	}
+
+	repo.touchFail = true
+	if _, err := service.Authenticate(context.Background(), valid.Key); err != nil {
+		t.Errorf("Authenticate with a failing usage record = %v", err)
+	}
+
+	for name, key := range map[string]string{
+		"revoked":        revoked.Key,
+		"expired":        expired.Key,
+		"unknown":        ApiKeyPrefix + "abcdefgh_unknown",
+		"altered secret": valid.Key + "x",
+	} {
+		if _, err := service.Authenticate(context.Background(), key); !errors.Is(err, ErrInvalidApiKey) {
+			t.Errorf("%s key: err = %v, want ErrInvalidApiKey", name, err)
+		}
+	}
+
+	lookups := repo.lookups
+	if _, err := service.Authenticate(context.Background(), "eyJhbGciOiJIUzI1NiJ9.e30.sig"); !errors.Is(err, ErrInvalidApiKey) || repo.lookups != lookups {
+		t.Errorf("a JWT was looked up as an api key: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+)
+
+// refreshTokenBytes is the entropy of opaque refresh tokens.
+const refreshTokenBytes = 32
+
+// dummyPasswordHash is compared against when the email is unknown so a
+// failed login takes the same time whether or not the account exists. It is
+// hashed on first use, bcrypt is too slow to run when the package loads.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword("not-a-real-password-hash")
+	return hash
+})
+
+type AuthServiceInterface interface {
+	Login(ctx context.Context, req *entities.LoginRequest) (entities.TokenPair, error)
+	Refresh(ctx context.Context, req *entities.RefreshRequest) (entities.TokenPair, error)
+	Logout(ctx context.Context, principal auth.Principal, refreshToken string) error
+	Authenticate(ctx context.Context, accessToken string) (auth.Principal, error)
+}
+
+type AuthService struct {
+	userRepo   repositories.UserRepositoryInterface
+	tokenRepo  repositories.TokenRepositoryInterface
+	db         *sqlx.DB
+	issuer     *auth.TokenIssuer
+	refreshTTL time.Duration
+}
+
+func NewAuthService(userRepo repositories.UserRepositoryInterface, tokenRepo repositories.TokenRepositoryInterface, db *sqlx.DB, issuer *auth.TokenIssuer, refreshTTL time.Duration) AuthServiceInterface {
+	return &AuthService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		db:         db,
+		issuer:     issuer,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Login checks the credentials and starts a new refresh token family.
+func (s *AuthService) Login(ctx context.Context, req *entities.LoginRequest) (entities.TokenPair, error) {
+	if err := req.Validate(); err != nil {
+		return entities.TokenPair{}, utils.FormatValidationError(err, req)
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, s.db, strings.ToLower(strings.TrimSpace(req.Email)))
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.CheckPassword(dummyPasswordHash(), req.Password)
+		return entities.TokenPair{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, req.Password) {
+		return entities.TokenPair{}, ErrInvalidCredentials
+	}
+
+	family, err := auth.RandomToken(16)
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	return s.issue(ctx, user, family)
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and a new
+// pair is issued in the same family. Presenting an already rotated token
+// means it leaked, so the whole family is revoked.
+func (s *AuthService) Refresh(ctx context.Context, req *entities.RefreshRequest) (entities.TokenPair, error) {
+	if err := req.Validate(); err != nil {
+		return entities.TokenPair{}, utils.FormatValidationError(err, req)
+	}
+
+	token, err := s.tokenRepo.GetRefreshTokenByHash(ctx, s.db, auth.HashToken(req.RefreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return entities.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	revoked, err := s.tokenRepo.RevokeRefreshToken(ctx, s.db, token.ID)
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+	if !revoked {
+		utils.LoggerFromContext(ctx).Warnf("refresh token reuse detected for user id:%d, revoking its family", token.UserID)
+		if err := s.tokenRepo.RevokeRefreshTokenFamily(ctx, s.db, token.Family); err != nil {
+			return entities.TokenPair{}, err
+		}
+		return entities.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetUserById(ctx, s.db, token.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	return s.issue(ctx, user, token.Family)
+}
+
+// Logout revokes the access token of the principal and, when given, the
+// refresh token family it belongs to.
+func (s *AuthService) Logout(ctx context.Context, principal auth.Principal, refreshToken string) error {
+	if err := s.tokenRepo.RevokeAccessToken(ctx, s.db, principal.TokenID, principal.ExpiresAt); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.tokenRepo.GetRefreshTokenByHash(ctx, s.db, auth.HashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// never let one user log out another user's session
+	if token.UserID != principal.UserID {
+		return nil
+	}
+
+	return s.tokenRepo.RevokeRefreshTokenFamily(ctx, s.db, token.Family)
+}
+
+// Authenticate verifies an access token and that it wasn't revoked.
+func (s *AuthService) Authenticate(ctx context.Context, accessToken string) (auth.Principal, error) {
+	principal, err := s.issuer.Parse(accessToken)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	revoked, err := s.tokenRepo.IsAccessTokenRevoked(ctx, s.db, principal.TokenID)
+	if err != nil {
+		return auth.Principal{}, fmt.Errorf("check token revocation: %w", err)
+	}
+	if revoked {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+func (s *AuthService) issue(ctx context.Context, user entities.User, family string) (entities.TokenPair, error) {
+	role, err := auth.ParseRole(user.Role)
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	accessToken, principal, err := s.issuer.Issue(user.ID, user.Email, role)
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	refreshToken, err := auth.RandomToken(refreshTokenBytes)
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	err = s.tokenRepo.CreateRefreshToken(ctx, s.db, &entities.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(refreshToken),
+		Family:    family,
+		ExpiresAt: time.Now().Add(s.refreshTTL).UTC(),
+	})
+	if err != nil {
+		return entities.TokenPair{}, err
+	}
+
+	return entities.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    principal.ExpiresAt,
+		RefreshToken: refreshToken,
+	}, nil
+}
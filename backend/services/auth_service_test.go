@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeUserRepo struct {
+	repositories.UserRepositoryInterface
+	users []entities.User
+}
+
+func (r *fakeUserRepo) GetUserByEmail(ctx context.Context, db *sqlx.DB, email string) (entities.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return entities.User{}, sql.ErrNoRows
+}
+
+func (r *fakeUserRepo) GetUserById(ctx context.Context, db *sqlx.DB, id int) (entities.User, error) {
+	for _, user := range r.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return entities.User{}, sql.ErrNoRows
+}
+
+// fakeTokenRepo keeps refresh tokens and revoked access tokens in memory.
+type fakeTokenRepo struct {
+	refresh []entities.RefreshToken
+	revoked map[string]bool
+}
+
+func newFakeTokenRepo() *fakeTokenRepo {
+	return &fakeTokenRepo{revoked: make(map[string]bool)}
+}
+
+func (r *fakeTokenRepo) CreateRefreshToken(ctx context.Context, db *sqlx.DB, token *entities.RefreshToken) error {
+	token.ID = len(r.refresh) + 1
+	r.refresh = append(r.refresh, *token)
+	return nil
+}
+
+func (r *fakeTokenRepo) GetRefreshTokenByHash(ctx context.Context, db *sqlx.DB, tokenHash string) (entities.RefreshToken, error) {
+	for _, token := range r.refresh {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return entities.RefreshToken{}, sql.ErrNoRows
+}
+
+func (r *fakeTokenRepo) RevokeRefreshToken(ctx context.Context, db *sqlx.DB, id int) (bool, error) {
+	token := &r.refresh[id-1]
+	if token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	return true, nil
+}
+
+func (r *fakeTokenRepo) RevokeRefreshTokenFamily(ctx context.Context, db *sqlx.DB, family string) error {
+	now := time.Now()
+	for i := range r.refresh {
+		if r.refresh[i].Family == family && r.refresh[i].RevokedAt == nil {
+			r.refresh[i].RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepo) RevokeAccessToken(ctx context.Context, db *sqlx.DB, jti string, expiresAt time.Time) error {
+	r.revoked[jti] = true
+	return nil
+}
+
+func (r *fakeTokenRepo) IsAccessTokenRevoked(ctx context.Context, db *sqlx.DB, jti string) (bool, error) {
+	return r.revoked[jti], nil
+}
+
+// activeFamilies counts the families that still have a usable token.
+func (r *fakeTokenRepo) activeFamilies() int {
+	families := make(map[string]bool)
+	for _, token := range r.refresh {
+		if token.RevokedAt == nil {
+			families[token.Family] = true
+		}
+	}
+	return len(families)
+}
+
+const testPassword = "correct horse battery"
+
+func newTestAuthService(t *testing.T) (AuthServiceInterface, *fakeTokenRepo) {
+	t.Helper()
+
+	hash, err := auth.HashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUserRepo{users: []entities.User{
+		{ID: 1, Email: "ada@example.com", PasswordHash: hash, Role: "librarian"},
+		{ID: 2, Email: "bob@example.com", PasswordHash: hash, Role: "viewer"},
+	}}
+	issuer, err := auth.NewTokenIssuer("0123456789abcdef0123456789abcdef", "library", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := newFakeTokenRepo()
+	return NewAuthService(users, tokens, nil, issuer, time.Hour), tokens
+}
+
+func login(t *testing.T, service AuthServiceInterface, email string) entities.TokenPair {
+	t.Helper()
+
+	pair, err := service.Login(context.Background(), &entities.LoginRequest{Email: email, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	return pair
+}
+
+func TestAuthServiceLogin(t *testing.T) {
+	service, _ := newTestAuthService(t)
+
+	pair := login(t, service, "ADA@example.com")
+	if pair.AccessToken == "" || pair.RefreshToken == "" || pair.TokenType != "Bearer" {
+		t.Errorf("pair = %+v", pair)
+	}
+
+	principal, err := service.Authenticate(context.Background(), pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if principal.UserID != 1 || principal.Role != auth.RoleLibrarian {
+		t.Errorf("principal = %+v", principal)
+	}
+
+	for _, req := range []entities.LoginRequest{
+		{Email: "ada@example.com", Password: "wrong password here"},
+		{Email: "nobody@example.com", Password: testPassword},
+	} {
+		if _, err := service.Login(context.Background(), &req); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s) = %v, want ErrInvalidCredentials", req.Email, err)
+		}
+	}
+}
+
+func TestAuthServiceRefreshRotates(t *testing.T) {
+	service, tokens := newTestAuthService(t)
+	first := login(t, service, "ada@example.com")
+
+	second, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: first.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("Refresh returned the tokens it was given")
+	}
+	if _, err := service.Authenticate(context.Background(), second.AccessToken); err != nil {
+		t.Errorf("Authenticate(refreshed) = %v", err)
+	}
+
+	third, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: second.RefreshToken})
+	if err != nil {
+		t.Fatalf("Refresh of the rotated token failed: %v", err)
+	}
+	if families := tokens.activeFamilies(); families != 1 {
+		t.Errorf("%d active families, want 1", families)
+	}
+
+	// presenting a rotated token again means it leaked, the whole family goes
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: first.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reused token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: third.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("latest token after reuse: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	if families := tokens.activeFamilies(); families != 0 {
+		t.Errorf("%d active families after reuse, want 0", families)
+	}
+}
+
+func TestAuthServiceRefreshRejects(t *testing.T) {
+	service, tokens := newTestAuthService(t)
+	pair := login(t, service, "ada@example.com")
+	other := login(t, service, "bob@example.com")
+
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: "never-issued"}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	tokens.refresh[0].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: pair.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+	// an expired token isn't rotated, so it doesn't count as reuse
+	if tokens.refresh[1].RevokedAt != nil {
+		t.Error("an expired refresh token revoked another family")
+	}
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: other.RefreshToken}); err != nil {
+		t.Errorf("Refresh of another session = %v", err)
+	}
+}
+
+func TestAuthServiceLogout(t *testing.T) {
+	service, tokens := newTestAuthService(t)
+	ada := login(t, service, "ada@example.com")
+	bob := login(t, service, "bob@example.com")
+
+	principal, err := service.Authenticate(context.Background(), ada.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a refresh token of another user leaves that session alone
+	if err := service.Logout(context.Background(), principal, bob.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := service.Authenticate(context.Background(), ada.AccessToken); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Authenticate after logout = %v, want ErrInvalidToken", err)
+	}
+	if families := tokens.activeFamilies(); families != 2 {
+		t.Errorf("%d active families, want both", families)
+	}
+
+	if err := service.Logout(context.Background(), principal, ada.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: ada.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after logout = %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := service.Refresh(context.Background(), &entities.RefreshRequest{RefreshToken: bob.RefreshToken}); err != nil {
+		t.Errorf("Refresh of bob's session = %v", err)
+	}
+}
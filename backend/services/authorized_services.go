@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/storage"
+)
+
+// The decorators below enforce permissions at the service layer, checking
+// the principal the auth middleware put in the context, so a route missing
+// its middleware or a caller outside HTTP can't skip them. Every method is
+// written out rather than embedding the inner service, a method added to
+// the interface has to decide its permission to compile. Denied calls
+// return an error wrapping auth.ErrUnauthenticated or auth.ErrForbidden.
+
+func require(ctx context.Context, permission auth.Permission) error {
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("%w: %s required", auth.ErrUnauthenticated, permission)
+	}
+
+	return auth.Require(principal, permission)
+}
+
+type authorizedBookService struct {
+	inner BookServiceInterface
+}
+
+// NewAuthorizedBookService checks books:write or books:delete before every
+// write, reads are public.
+func NewAuthorizedBookService(inner BookServiceInterface) BookServiceInterface {
+	return &authorizedBookService{inner: inner}
+}
+
+func (s *authorizedBookService) GetBooks(ctx context.Context) ([]entities.Book, error) {
+	return s.inner.GetBooks(ctx)
+}
+
+func (s *authorizedBookService) GetBookById(ctx context.Context, id string) (entities.Book, error) {
+	return s.inner.GetBookById(ctx, id)
+}
+
+func (s *authorizedBookService) AddBook(ctx context.Context, book *entities.Book, opts AddBookOptions) error {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return err
+	}
+
+	return s.inner.AddBook(ctx, book, opts)
+}
+
+func (s *authorizedBookService) LookupBook(ctx context.Context, isbn string) (entities.Book, error) {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return entities.Book{}, err
+	}
+
+	return s.inner.LookupBook(ctx, isbn)
+}
+
+func (s *authorizedBookService) UpdateBook(ctx context.Context, id string, book *entities.Book) error {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return err
+	}
+
+	return s.inner.UpdateBook(ctx, id, book)
+}
+
+func (s *authorizedBookService) DeleteBook(ctx context.Context, id string) error {
+	if err := require(ctx, auth.PermBooksDelete); err != nil {
+		return err
+	}
+
+	return s.inner.DeleteBook(ctx, id)
+}
+
+type authorizedUserService struct {
+	inner UserServiceInterface
+}
+
+// NewAuthorizedUserService requires members:manage for every call.
+func NewAuthorizedUserService(inner UserServiceInterface) UserServiceInterface {
+	return &authorizedUserService{inner: inner}
+}
+
+func (s *authorizedUserService) GetUsers(ctx context.Context) ([]entities.User, error) {
+	if err := require(ctx, auth.PermMembersManage); err != nil {
+		return nil, err
+	}
+
+	return s.inner.GetUsers(ctx)
+}
+
+func (s *authorizedUserService) CreateUser(ctx context.Context, req *entities.CreateUserRequest) (entities.User, error) {
+	if err := require(ctx, auth.PermMembersManage); err != nil {
+		return entities.User{}, err
+	}
+
+	return s.inner.CreateUser(ctx, req)
+}
+
+func (s *authorizedUserService) UpdateUserRole(ctx context.Context, id int, req *entities.UpdateUserRoleRequest) error {
+	if err := require(ctx, auth.PermMembersManage); err != nil {
+		return err
+	}
+
+	return s.inner.UpdateUserRole(ctx, id, req)
+}
+
+type authorizedCoverService struct {
+	inner CoverServiceInterface
+}
+
+// NewAuthorizedCoverService checks books:write before storing a cover or
+// listing broken ones, covers themselves are public.
+func NewAuthorizedCoverService(inner CoverServiceInterface) CoverServiceInterface {
+	return &authorizedCoverService{inner: inner}
+}
+
+func (s *authorizedCoverService) UploadCover(ctx context.Context, id string, r io.Reader) error {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return err
+	}
+
+	return s.inner.UploadCover(ctx, id, r)
+}
+
+func (s *authorizedCoverService) SaveCover(ctx context.Context, id string, r io.Reader) error {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return err
+	}
+
+	return s.inner.SaveCover(ctx, id, r)
+}
+
+func (s *authorizedCoverService) GetCover(ctx context.Context, id, size string) (io.ReadCloser, storage.BlobInfo, error) {
+	return s.inner.GetCover(ctx, id, size)
+}
+
+func (s *authorizedCoverService) GetBrokenCovers(ctx context.Context) ([]entities.CoverCheck, error) {
+	if err := require(ctx, auth.PermBooksWrite); err != nil {
+		return nil, err
+	}
+
+	return s.inner.GetBrokenCovers(ctx)
+}
+
+type authorizedLinkService struct {
+	inner LinkServiceInterface
+}
+
+// NewAuthorizedLinkService requires urls:process to create a link or read
+// its stats, following one is public.
+func NewAuthorizedLinkService(inner LinkServiceInterface) LinkServiceInterface {
+	return &authorizedLinkService{inner: inner}
+}
+
+func (s *authorizedLinkService) CreateLink(ctx context.Context, req *entities.CreateShortLinkRequest) (entities.ShortLink, error) {
+	if err := require(ctx, auth.PermUrlsProcess); err != nil {
+		return entities.ShortLink{}, err
+	}
+
+	return s.inner.CreateLink(ctx, req)
+}
+
+func (s *authorizedLinkService) FollowLink(ctx context.Context, code, referrer, userAgent string) (entities.ShortLink, error) {
+	return s.inner.FollowLink(ctx, code, referrer, userAgent)
+}
+
+func (s *authorizedLinkService) GetLinkStats(ctx context.Context, code string) (entities.ShortLinkStats, error) {
+	if err := require(ctx, auth.PermUrlsProcess); err != nil {
+		return entities.ShortLinkStats{}, err
+	}
+
+	return s.inner.GetLinkStats(ctx, code)
+}
+
+type authorizedUrlService struct {
+	inner UrlServiceInterface
+}
+
+// NewAuthorizedUrlService requires urls:process for every operation on a
+// URL, validation and the operation list don't touch one.
+func NewAuthorizedUrlService(inner UrlServiceInterface) UrlServiceInterface {
+	return &authorizedUrlService{inner: inner}
+}
+
+func (s *authorizedUrlService) ProcessUrl(ctx context.Context, rawURL, operation string) (string, error) {
+	if err := require(ctx, auth.PermUrlsProcess); err != nil {
+		return "", err
+	}
+
+	return s.inner.ProcessUrl(ctx, rawURL, operation)
+}
+
+func (s *authorizedUrlService) ResolveUrl(ctx context.Context, rawURL string) (entities.URLResolution, error) {
+	if err := require(ctx, auth.PermUrlsProcess); err != nil {
+		return entities.URLResolution{}, err
+	}
+
+	return s.inner.ResolveUrl(ctx, rawURL)
+}
+
+func (s *authorizedUrlService) ExplainUrl(ctx context.Context, rawURL, operation string) (entities.URLExplanation, error) {
+	if err := require(ctx, auth.PermUrlsProcess); err != nil {
+		return entities.URLExplanation{}, err
+	}
+
+	return s.inner.ExplainUrl(ctx, rawURL, operation)
+}
+
+func (s *authorizedUrlService) ValidateRequest(req entities.URLRequest) error {
+	return s.inner.ValidateRequest(req)
+}
+
+func (s *authorizedUrlService) Operations() []entities.URLOperationInfo {
+	return s.inner.Operations()
+}
+
+type authorizedApiKeyService struct {
+	inner ApiKeyServiceInterface
+}
+
+// NewAuthorizedApiKeyService requires api-keys:manage to create, list or
+// revoke keys. Authenticate runs before there is a principal and stays
+// open.
+func NewAuthorizedApiKeyService(inner ApiKeyServiceInterface) ApiKeyServiceInterface {
+	return &authorizedApiKeyService{inner: inner}
+}
+
+func (s *authorizedApiKeyService) CreateApiKey(ctx context.Context, creator auth.Principal, req *entities.CreateApiKeyRequest) (entities.ApiKey, error) {
+	if err := require(ctx, auth.PermAPIKeysManage); err != nil {
+		return entities.ApiKey{}, err
+	}
+
+	return s.inner.CreateApiKey(ctx, creator, req)
+}
+
+func (s *authorizedApiKeyService) GetApiKeys(ctx context.Context) ([]entities.ApiKey, error) {
+	if err := require(ctx, auth.PermAPIKeysManage); err != nil {
+		return nil, err
+	}
+
+	return s.inner.GetApiKeys(ctx)
+}
+
+func (s *authorizedApiKeyService) RevokeApiKey(ctx context.Context, id int) error {
+	if err := require(ctx, auth.PermAPIKeysManage); err != nil {
+		return err
+	}
+
+	return s.inner.RevokeApiKey(ctx, id)
+}
+
+func (s *authorizedApiKeyService) Authenticate(ctx context.Context, key string) (auth.Principal, error) {
+	return s.inner.Authenticate(ctx, key)
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/storage"
+)
+
+// recordingBookService counts the calls that got through the decorator.
+type recordingBookService struct {
+	calls int
+}
+
+func (s *recordingBookService) GetBooks(ctx context.Context) ([]entities.Book, error) {
+	s.calls++
+	return nil, nil
+}
+
+func (s *recordingBookService) AddBook(ctx context.Context, book *entities.Book, opts AddBookOptions) error {
+	s.calls++
+	return nil
+}
+
+func (s *recordingBookService) LookupBook(ctx context.Context, isbn string) (entities.Book, error) {
+	s.calls++
+	return entities.Book{}, nil
+}
+
+func (s *recordingBookService) GetBookById(ctx context.Context, id string) (entities.Book, error) {
+	s.calls++
+	return entities.Book{}, nil
+}
+
+func (s *recordingBookService) UpdateBook(ctx context.Context, id string, book *entities.Book) error {
+	s.calls++
+	return nil
+}
+
+func (s *recordingBookService) DeleteBook(ctx context.Context, id string) error {
+	s.calls++
+	return nil
+}
+
+func TestAuthorizedBookService(t *testing.T) {
+	calls := map[string]func(BookServiceInterface, context.Context) error{
+		"GetBooks": func(s BookServiceInterface, ctx context.Context) error {
+			_, err := s.GetBooks(ctx)
+			return err
+		},
+		"GetBookById": func(s BookServiceInterface, ctx context.Context) error {
+			_, err := s.GetBookById(ctx, "1")
+			return err
+		},
+		"AddBook": func(s BookServiceInterface, ctx context.Context) error {
+			return s.AddBook(ctx, &entities.Book{}, AddBookOptions{})
+		},
+		"LookupBook": func(s BookServiceInterface, ctx context.Context) error {
+			_, err := s.LookupBook(ctx, "9780000000000")
+			return err
+		},
+		"UpdateBook": func(s BookServiceInterface, ctx context.Context) error {
+			return s.UpdateBook(ctx, "1", &entities.Book{})
+		},
+		"DeleteBook": func(s BookServiceInterface, ctx context.Context) error {
+			return s.DeleteBook(ctx, "1")
+		},
+	}
+
+	anonymous := context.Background()
+	viewer := auth.WithPrincipal(anonymous, auth.Principal{UserID: 1, Role: auth.RoleViewer})
+	librarian := auth.WithPrincipal(anonymous, auth.Principal{UserID: 2, Role: auth.RoleLibrarian})
+	readOnlyKey := auth.WithPrincipal(anonymous, auth.Principal{APIKeyID: 3, Scopes: []auth.Permission{auth.PermUrlsProcess}})
+
+	tests := []struct {
+		name    string
+		method  string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "anonymous read", method: "GetBooks", ctx: anonymous},
+		{name: "anonymous read by id", method: "GetBookById", ctx: anonymous},
+		{name: "anonymous write", method: "AddBook", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "viewer write", method: "AddBook", ctx: viewer, wantErr: auth.ErrForbidden},
+		{name: "viewer lookup", method: "LookupBook", ctx: viewer, wantErr: auth.ErrForbidden},
+		{name: "librarian write", method: "AddBook", ctx: librarian},
+		{name: "librarian lookup", method: "LookupBook", ctx: librarian},
+		{name: "librarian update", method: "UpdateBook", ctx: librarian},
+		{name: "librarian delete", method: "DeleteBook", ctx: librarian, wantErr: auth.ErrForbidden},
+		{name: "api key without scope", method: "UpdateBook", ctx: readOnlyKey, wantErr: auth.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &recordingBookService{}
+
+			err := calls[tt.method](NewAuthorizedBookService(inner), tt.ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if denied := tt.wantErr != nil; denied != (inner.calls == 0) {
+				t.Errorf("inner service called %d times, denied %v", inner.calls, denied)
+			}
+		})
+	}
+}
+
+// recordingServices stands in for the cover, link, url and api key services
+// and counts the calls that got through their decorators.
+type recordingServices struct {
+	CoverServiceInterface
+	LinkServiceInterface
+	UrlServiceInterface
+	ApiKeyServiceInterface
+	calls int
+}
+
+func (s *recordingServices) UploadCover(ctx context.Context, id string, r io.Reader) error {
+	s.calls++
+	return nil
+}
+
+func (s *recordingServices) SaveCover(ctx context.Context, id string, r io.Reader) error {
+	s.calls++
+	return nil
+}
+
+func (s *recordingServices) GetCover(ctx context.Context, id, size string) (io.ReadCloser, storage.BlobInfo, error) {
+	s.calls++
+	return io.NopCloser(strings.NewReader("")), storage.BlobInfo{}, nil
+}
+
+func (s *recordingServices) GetBrokenCovers(ctx context.Context) ([]entities.CoverCheck, error) {
+	s.calls++
+	return nil, nil
+}
+
+func (s *recordingServices) CreateLink(ctx context.Context, req *entities.CreateShortLinkRequest) (entities.ShortLink, error) {
+	s.calls++
+	return entities.ShortLink{}, nil
+}
+
+func (s *recordingServices) FollowLink(ctx context.Context, code, referrer, userAgent string) (entities.ShortLink, error) {
+	s.calls++
+	return entities.ShortLink{}, nil
+}
+
+func (s *recordingServices) GetLinkStats(ctx context.Context, code string) (entities.ShortLinkStats, error) {
+	s.calls++
+	return entities.ShortLinkStats{}, nil
+}
+
+func (s *recordingServices) ProcessUrl(ctx context.Context, rawURL, operation string) (string, error) {
+	s.calls++
+	return rawURL, nil
+}
+
+func (s *recordingServices) ResolveUrl(ctx context.Context, rawURL string) (entities.URLResolution, error) {
+	s.calls++
+	return entities.URLResolution{}, nil
+}
+
+func (s *recordingServices) ExplainUrl(ctx context.Context, rawURL, operation string) (entities.URLExplanation, error) {
+	s.calls++
+	return entities.URLExplanation{}, nil
+}
+
+func (s *recordingServices) CreateApiKey(ctx context.Context, creator auth.Principal, req *entities.CreateApiKeyRequest) (entities.ApiKey, error) {
+	s.calls++
+	return entities.ApiKey{}, nil
+}
+
+func (s *recordingServices) GetApiKeys(ctx context.Context) ([]entities.ApiKey, error) {
+	s.calls++
+	return nil, nil
+}
+
+func (s *recordingServices) RevokeApiKey(ctx context.Context, id int) error {
+	s.calls++
+	return nil
+}
+
+func (s *recordingServices) Authenticate(ctx context.Context, key string) (auth.Principal, error) {
+	s.calls++
+	return auth.Principal{}, nil
+}
+
+func TestAuthorizedServices(t *testing.T) {
+	calls := map[string]func(*recordingServices, context.Context) error{
+		"UploadCover": func(s *recordingServices, ctx context.Context) error {
+			return NewAuthorizedCoverService(s).UploadCover(ctx, "1", strings.NewReader("cover"))
+		},
+		"SaveCover": func(s *recordingServices, ctx context.Context) error {
+			return NewAuthorizedCoverService(s).SaveCover(ctx, "1", strings.NewReader("cover"))
+		},
+		"GetCover": func(s *recordingServices, ctx context.Context) error {
+			_, _, err := NewAuthorizedCoverService(s).GetCover(ctx, "1", "")
+			return err
+		},
+		"GetBrokenCovers": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedCoverService(s).GetBrokenCovers(ctx)
+			return err
+		},
+		"CreateLink": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedLinkService(s).CreateLink(ctx, &entities.CreateShortLinkRequest{})
+			return err
+		},
+		"FollowLink": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedLinkService(s).FollowLink(ctx, "abc", "", "")
+			return err
+		},
+		"GetLinkStats": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedLinkService(s).GetLinkStats(ctx, "abc")
+			return err
+		},
+		"ProcessUrl": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedUrlService(s).ProcessUrl(ctx, "https://example.com", "canonical")
+			return err
+		},
+		"ResolveUrl": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedUrlService(s).ResolveUrl(ctx, "https://example.com")
+			return err
+		},
+		"ExplainUrl": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedUrlService(s).ExplainUrl(ctx, "https://example.com", "canonical")
+			return err
+		},
+		"CreateApiKey": func(s *recordingServices, ctx context.Context) error {
+			principal, _ := auth.PrincipalFromContext(ctx)
+			_, err := NewAuthorizedApiKeyService(s).CreateApiKey(ctx, principal, &entities.CreateApiKeyRequest{})
+			return err
+		},
+		"GetApiKeys": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedApiKeyService(s).GetApiKeys(ctx)
+			return err
+		},
+		"RevokeApiKey": func(s *recordingServices, ctx context.Context) error {
+			return NewAuthorizedApiKeyService(s).RevokeApiKey(ctx, 1)
+		},
+		"Authenticate": func(s *recordingServices, ctx context.Context) error {
+			_, err := NewAuthorizedApiKeyService(s).Authenticate(ctx, "mbl_1_secret")
+			return err
+		},
+	}
+
+	anonymous := context.Background()
+	viewer := auth.WithPrincipal(anonymous, auth.Principal{UserID: 1, Role: auth.RoleViewer})
+	librarian := auth.WithPrincipal(anonymous, auth.Principal{UserID: 2, Role: auth.RoleLibrarian})
+	admin := auth.WithPrincipal(anonymous, auth.Principal{UserID: 3, Role: auth.RoleAdmin})
+	urlsKey := auth.WithPrincipal(anonymous, auth.Principal{APIKeyID: 4, Scopes: []auth.Permission{auth.PermUrlsProcess}})
+
+	tests := []struct {
+		name    string
+		method  string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "anonymous cover", method: "GetCover", ctx: anonymous},
+		{name: "anonymous upload", method: "UploadCover", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "viewer upload", method: "UploadCover", ctx: viewer, wantErr: auth.ErrForbidden},
+		{name: "librarian upload", method: "UploadCover", ctx: librarian},
+		{name: "anonymous mirror", method: "SaveCover", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "viewer broken covers", method: "GetBrokenCovers", ctx: viewer, wantErr: auth.ErrForbidden},
+		{name: "librarian broken covers", method: "GetBrokenCovers", ctx: librarian},
+
+		{name: "anonymous follow", method: "FollowLink", ctx: anonymous},
+		{name: "anonymous create link", method: "CreateLink", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "viewer create link", method: "CreateLink", ctx: viewer},
+		{name: "api key link stats", method: "GetLinkStats", ctx: urlsKey},
+
+		{name: "anonymous process", method: "ProcessUrl", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "anonymous resolve", method: "ResolveUrl", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "viewer explain", method: "ExplainUrl", ctx: viewer},
+		{name: "api key resolve", method: "ResolveUrl", ctx: urlsKey},
+
+		{name: "anonymous authenticate", method: "Authenticate", ctx: anonymous},
+		{name: "librarian create key", method: "CreateApiKey", ctx: librarian, wantErr: auth.ErrForbidden},
+		{name: "api key lists keys", method: "GetApiKeys", ctx: urlsKey, wantErr: auth.ErrForbidden},
+		{name: "anonymous revoke", method: "RevokeApiKey", ctx: anonymous, wantErr: auth.ErrUnauthenticated},
+		{name: "admin create key", method: "CreateApiKey", ctx: admin},
+		{name: "admin revoke", method: "RevokeApiKey", ctx: admin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &recordingServices{}
+
+			err := calls[tt.method](inner, tt.ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if denied := tt.wantErr != nil; denied != (inner.calls == 0) {
+				t.Errorf("inner service called %d times, denied %v", inner.calls, denied)
+			}
+		})
+	}
+
+	// validation doesn't need a principal
+	urls := NewAuthorizedUrlService(&recordingServices{UrlServiceInterface: NewUrlService(NewOperationRegistry(), nil)})
+	if err := urls.ValidateRequest(entities.URLRequest{}); err == nil {
+		t.Error("ValidateRequest accepted an empty request")
+	}
+}
@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"errors"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/goesbams/mini-books-library/backend/entities"
 	"github.com/goesbams/mini-books-library/backend/repositories"
@@ -8,25 +11,36 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+var ErrMetadataDisabled = errors.New("metadata lookup is disabled")
+
 type BookServiceInterface interface {
-	GetBooks() ([]entities.Book, error)
-	AddBook(*entities.Book) error
-	GetBookById(id string) (entities.Book, error)
-	UpdateBook(id string, book *entities.Book) error
-	DeleteBook(id string) error
+	GetBooks(ctx context.Context) ([]entities.Book, error)
+	AddBook(ctx context.Context, book *entities.Book, opts AddBookOptions) error
+	LookupBook(ctx context.Context, isbn string) (entities.Book, error)
+	GetBookById(ctx context.Context, id string) (entities.Book, error)
+	UpdateBook(ctx context.Context, id string, book *entities.Book) error
+	DeleteBook(ctx context.Context, id string) error
+}
+
+// AddBookOptions tweaks how AddBook treats the submitted book.
+type AddBookOptions struct {
+	// Autofill fills fields left empty from the metadata provider using the ISBN.
+	Autofill bool
 }
 
 type BookService struct {
-	repo repositories.BookRepositoryInterface
-	db   *sqlx.DB
+	repo     repositories.BookRepositoryInterface
+	db       *sqlx.DB
+	metadata MetadataProvider
 }
 
-func NewBookService(repo repositories.BookRepositoryInterface, db *sqlx.DB) BookServiceInterface {
-	return &BookService{repo: repo, db: db}
+// NewBookService builds the book service, metadata may be nil to disable ISBN lookups.
+func NewBookService(repo repositories.BookRepositoryInterface, db *sqlx.DB, metadata MetadataProvider) BookServiceInterface {
+	return &BookService{repo: repo, db: db, metadata: metadata}
 }
 
-func (s *BookService) GetBooks() ([]entities.Book, error) {
-	books, err := s.repo.GetBooks(s.db)
+func (s *BookService) GetBooks(ctx context.Context) ([]entities.Book, error) {
+	books, err := s.repo.GetBooks(ctx, s.db)
 	if err != nil {
 		return nil, err
 	}
@@ -34,19 +48,68 @@ func (s *BookService) GetBooks() ([]entities.Book, error) {
 	return books, nil
 }
 
-func (s *BookService) AddBook(book *entities.Book) error {
+func (s *BookService) AddBook(ctx context.Context, book *entities.Book, opts AddBookOptions) error {
+	if opts.Autofill && book.Isbn != "" {
+		s.autofill(ctx, book)
+	}
+
 	if err := book.Validate(); err != nil {
 		return utils.FormatValidationError(err, book)
 	}
 
-	return s.repo.AddBook(s.db, book)
+	return s.repo.AddBook(ctx, s.db, book)
+}
+
+func (s *BookService) LookupBook(ctx context.Context, isbn string) (entities.Book, error) {
+	validate := validator.New()
+	if err := validate.Var(isbn, "len=13,numeric"); err != nil {
+		return entities.Book{}, utils.ValidationError{
+			Errors: []utils.FieldError{{Field: "isbn", Rule: "len=13,numeric"}},
+		}
+	}
+
+	if s.metadata == nil {
+		return entities.Book{}, ErrMetadataDisabled
+	}
+
+	return s.metadata.LookupByIsbn(ctx, isbn)
+}
+
+// autofill copies metadata into the fields the caller left empty. Lookup
+// failures are logged and ignored so that adding a book never depends on
+// the external source being reachable.
+func (s *BookService) autofill(ctx context.Context, book *entities.Book) {
+	draft, err := s.LookupBook(ctx, book.Isbn)
+	if err != nil {
+		utils.LoggerFromContext(ctx).WithError(err).WithField("isbn", book.Isbn).Warn("unable to autofill book")
+		return
+	}
+
+	if book.Title == "" {
+		book.Title = draft.Title
+	}
+	if book.Author == "" {
+		book.Author = draft.Author
+	}
+	if book.CoverImageUrl == "" {
+		book.CoverImageUrl = draft.CoverImageUrl
+	}
+	if book.Description == "" {
+		book.Description = draft.Description
+	}
+	if book.PublicationDate == "" {
+		book.PublicationDate = draft.PublicationDate
+	}
+	if book.NumberOfPages == 0 {
+		book.NumberOfPages = draft.NumberOfPages
+	}
 }
 
-func (s *BookService) GetBookById(id string) (entities.Book, error) {
-	return s.repo.GetBookById(s.db, id)
+func (s *BookService) GetBookById(ctx context.Context, id string) (entities.Book, error) {
+	return s.repo.GetBookById(ctx, s.db, id)
 }
 
-func (s *BookService) UpdateBook(id string, book *entities.Book) error {
+func (s *BookService) UpdateBook(ctx context.Context, id string, book *entities.Book) error {
 	validate := validator.New()
 
 	var validationErrors []utils.FieldError
@@ -107,9 +170,9 @@ func (s *BookService) UpdateBook(id string, book *entities.Book) error {
 		return utils.ValidationError{Errors: validationErrors}
 	}
 
-	return s.repo.UpdateBook(s.db, id, book)
+	return s.repo.UpdateBook(ctx, s.db, id, book)
 }
 
-func (s *BookService) DeleteBook(id string) error {
-	return s.repo.DeleteBook(s.db, id)
+func (s *BookService) DeleteBook(ctx context.Context, id string) error {
+	return s.repo.DeleteBook(ctx, s.db, id)
 }
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/storage"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image type, expected jpeg, png or webp")
+	ErrImageTooLarge    = errors.New("image exceeds the maximum upload size")
+	ErrUnknownCoverSize = errors.New("unknown cover size")
+)
+
+// allowedCoverTypes lists the sniffed MIME types accepted for uploads.
+var allowedCoverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// CoverSizes maps thumbnail names to their maximum width in pixels.
+var CoverSizes = map[string]int{
+	"small":  160,
+	"medium": 320,
+	"large":  640,
+}
+
+// maxCoverPixels guards against decompression bombs hidden in small files.
+const maxCoverPixels = 40_000_000
+
+type CoverServiceInterface interface {
+	UploadCover(ctx context.Context, id string, r io.Reader) error
+	SaveCover(ctx context.Context, id string, r io.Reader) error
+	GetCover(ctx context.Context, id, size string) (io.ReadCloser, storage.BlobInfo, error)
+	GetBrokenCovers(ctx context.Context) ([]entities.CoverCheck, error)
+}
+
+type CoverService struct {
+	repo          repositories.BookRepositoryInterface
+	checkRepo     repositories.CoverCheckRepositoryInterface
+	db            *sqlx.DB
+	store         storage.BlobStore
+	maxUploadSize int64
+	publicBaseURL string
+}
+
+func NewCoverService(repo repositories.BookRepositoryInterface, checkRepo repositories.CoverCheckRepositoryInterface, db *sqlx.DB, store storage.BlobStore, maxUploadSize int64, publicBaseURL string) CoverServiceInterface {
+	return &CoverService{
+		repo:          repo,
+		checkRepo:     checkRepo,
+		db:            db,
+		store:         store,
+		maxUploadSize: maxUploadSize,
+		publicBaseURL: publicBaseURL,
+	}
+}
+
+func coverKey(id, size string) string {
+	if size == "" {
+		return fmt.Sprintf("covers/%s/original", id)
+	}
+
+	return fmt.Sprintf("covers/%s/%s.jpg", id, size)
+}
+
+// UploadCover stores a new cover for the book and points its
+// cover_image_url at the served copy.
+func (s *CoverService) UploadCover(ctx context.Context, id string, r io.Reader) error {
+	// such a book can't exist, and postgres would reject the id as input
+	if _, err := strconv.Atoi(id); err != nil {
+		return sql.ErrNoRows
+	}
+
+	if _, err := s.repo.GetBookById(ctx, s.db, id); err != nil {
+		return err
+	}
+
+	if err := s.SaveCover(ctx, id, r); err != nil {
+		return err
+	}
+
+	if s.publicBaseURL == "" {
+		return nil
+	}
+
+	// the version query busts caches that hold a previous upload
+	coverURL := fmt.Sprintf("%s/books/%s/cover?v=%d", s.publicBaseURL, id, time.Now().Unix())
+	return s.repo.UpdateBook(ctx, s.db, id, &entities.Book{CoverImageUrl: coverURL})
+}
+
+// SaveCover validates the image, stores the original and generates every
+// thumbnail size without touching the book record. Thumbnails are written
+// before the original and removed again when a write fails, so a failed
+// upload never leaves new thumbnails beside the previous original.
+func (s *CoverService) SaveCover(ctx context.Context, id string, r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, s.maxUploadSize+1))
+	if err != nil {
+		return fmt.Errorf("read cover: %w", err)
+	}
+
+	if int64(len(data)) > s.maxUploadSize {
+		return ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedCoverTypes[contentType] {
+		return ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxCoverPixels {
+		return ErrUnsupportedImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ErrUnsupportedImage
+	}
+
+	thumbnails := make(map[string][]byte, len(CoverSizes))
+	for size, width := range CoverSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(img, width), &jpeg.Options{Quality: 85}); err != nil {
+			return fmt.Errorf("encode %s thumbnail: %w", size, err)
+		}
+		thumbnails[size] = buf.Bytes()
+	}
+
+	var written []string
+	for size, thumbnail := range thumbnails {
+		if err := s.store.Put(coverKey(id, size), bytes.NewReader(thumbnail), "image/jpeg"); err != nil {
+			s.removeBlobs(ctx, written)
+			return err
+		}
+		written = append(written, coverKey(id, size))
+	}
+
+	if err := s.store.Put(coverKey(id, ""), bytes.NewReader(data), contentType); err != nil {
+		s.removeBlobs(ctx, written)
+		return err
+	}
+
+	return nil
+}
+
+func (s *CoverService) removeBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.store.Delete(key); err != nil {
+			utils.LoggerFromContext(ctx).WithError(err).WithField("key", key).Warn("unable to remove cover blob of a failed upload")
+		}
+	}
+}
+
+// GetCover returns the original upload when size is empty, otherwise the
+// named thumbnail.
+func (s *CoverService) GetCover(ctx context.Context, id, size string) (io.ReadCloser, storage.BlobInfo, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return nil, storage.BlobInfo{}, storage.ErrBlobNotFound
+	}
+
+	if size != "" {
+		if _, ok := CoverSizes[size]; !ok {
+			return nil, storage.BlobInfo{}, ErrUnknownCoverSize
+		}
+	}
+
+	return s.store.Get(coverKey(id, size))
+}
+
+// GetBrokenCovers lists the books whose cover URL failed its last health check.
+func (s *CoverService) GetBrokenCovers(ctx context.Context) ([]entities.CoverCheck, error) {
+	return s.checkRepo.GetBrokenCovers(ctx, s.db)
+}
+
+// resize scales img down to the given width keeping its aspect ratio,
+// smaller images are never upscaled.
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		width = bounds.Dx()
+	}
+
+	height := bounds.Dy() * width / bounds.Dx()
+	if height == 0 {
+		height = 1
+	}
+
+	// flatten transparency onto white since thumbnails are JPEG
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
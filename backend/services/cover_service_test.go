@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/storage"
+)
+
+// memoryStore is a BlobStore in a map, failing the Put of failKey.
+type memoryStore struct {
+	blobs   map[string][]byte
+	failKey string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{blobs: make(map[string][]byte)}
+}
+
+func (s *memoryStore) Put(key string, r io.Reader, contentType string) error {
+	if key == s.failKey {
+		return errors.New("store unavailable")
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memoryStore) Get(key string) (io.ReadCloser, storage.BlobInfo, error) {
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, storage.BlobInfo{}, storage.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), storage.BlobInfo{Size: int64(len(data))}, nil
+}
+
+func (s *memoryStore) Delete(key string) error {
+	delete(s.blobs, key)
+	return nil
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 200, A: 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withDimensions rewrites the size a PNG header claims, the pixel data
+// stays that of the small image like in a decompression bomb.
+func withDimensions(data []byte, width, height uint32) []byte {
+	out := append([]byte(nil), data...)
+	// signature (8), chunk length (4) and type (4) precede the IHDR data
+	binary.BigEndian.PutUint32(out[16:], width)
+	binary.BigEndian.PutUint32(out[20:], height)
+	binary.BigEndian.PutUint32(out[29:], crc32.ChecksumIEEE(out[12:29]))
+	return out
+}
+
+func TestSaveCover(t *testing.T) {
+	var gifImage bytes.Buffer
+	gif.Encode(&gifImage, image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.White}), nil)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "png", data: testPNG(t, 800, 1200)},
+		{name: "plain text", data: []byte("definitely not an image"), wantErr: ErrUnsupportedImage},
+		{name: "html", data: []byte("<html><body><img src=x></body></html>"), wantErr: ErrUnsupportedImage},
+		{name: "gif", data: gifImage.Bytes(), wantErr: ErrUnsupportedImage},
+		{name: "truncated png", data: testPNG(t, 64, 64)[:40], wantErr: ErrUnsupportedImage},
+		{name: "too many pixels", data: withDimensions(testPNG(t, 4, 4), 10000, 10000), wantErr: ErrUnsupportedImage},
+		{name: "too large", data: append(testPNG(t, 4, 4), make([]byte, 64<<10)...), wantErr: ErrImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			service := &CoverService{store: store, maxUploadSize: 64 << 10}
+
+			err := service.SaveCover(context.Background(), "7", bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(store.blobs) != 0 {
+					t.Errorf("rejected cover stored %d blobs", len(store.blobs))
+				}
+				return
+			}
+
+			if !bytes.Equal(store.blobs["covers/7/original"], tt.data) {
+				t.Error("original not stored as uploaded")
+			}
+			for size, width := range CoverSizes {
+				thumbnail, ok := store.blobs["covers/7/"+size+".jpg"]
+				if !ok {
+					t.Fatalf("%s thumbnail missing", size)
+				}
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+				if err != nil || format != "jpeg" || cfg.Width != width {
+					t.Errorf("%s thumbnail is %s %dx%d (%v), want jpeg %d wide", size, format, cfg.Width, cfg.Height, err, width)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveCoverFailedWriteKeepsPreviousCover(t *testing.T) {
+	store := newMemoryStore()
+	service := &CoverService{store: store, maxUploadSize: 1 << 20}
+	if err := service.SaveCover(context.Background(), "7", bytes.NewReader(testPNG(t, 800, 800))); err != nil {
+		t.Fatal(err)
+	}
+	previous := make(map[string][]byte, len(store.blobs))
+	for key, blob := range store.blobs {
+		previous[key] = blob
+	}
+
+	store.failKey = "covers/7/original"
+	if err := service.SaveCover(context.Background(), "7", bytes.NewReader(testPNG(t, 300, 300))); err == nil {
+		t.Fatal("SaveCover succeeded with a failing store")
+	}
+
+	if !bytes.Equal(store.blobs["covers/7/original"], previous["covers/7/original"]) {
+		t.Error("previous original was replaced")
+	}
+	for size := range CoverSizes {
+		key := "covers/7/" + size + ".jpg"
+		if blob, ok := store.blobs[key]; ok && !bytes.Equal(blob, previous[key]) {
+			t.Errorf("%s thumbnail of the failed upload left beside the previous original", size)
+		}
+	}
+}
+
+func TestUploadCoverRejectsInvalidID(t *testing.T) {
+	service := &CoverService{store: newMemoryStore(), maxUploadSize: 1 << 20}
+
+	err := service.UploadCover(context.Background(), "abc", strings.NewReader("x"))
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("err = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrLinkCodeTaken = errors.New("short link code is already taken")
+	ErrLinkExpired   = errors.New("short link has expired")
+)
+
+const (
+	codeAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 7
+	// codeAttempts bounds retries when a random code collides with an
+	// existing one, at 7 characters this is practically never reached.
+	codeAttempts = 5
+)
+
+var slugPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type LinkServiceInterface interface {
+	CreateLink(ctx context.Context, req *entities.CreateShortLinkRequest) (entities.ShortLink, error)
+	FollowLink(ctx context.Context, code, referrer, userAgent string) (entities.ShortLink, error)
+	GetLinkStats(ctx context.Context, code string) (entities.ShortLinkStats, error)
+}
+
+type LinkService struct {
+	repo    repositories.LinkRepositoryInterface
+	db      *sqlx.DB
+	baseURL string
+}
+
+// NewLinkService builds the short link service, baseURL is prepended to
+// codes to build the short URL returned to clients.
+func NewLinkService(repo repositories.LinkRepositoryInterface, db *sqlx.DB, baseURL string) LinkServiceInterface {
+	return &LinkService{repo: repo, db: db, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (s *LinkService) CreateLink(ctx context.Context, req *entities.CreateShortLinkRequest) (entities.ShortLink, error) {
+	if err := req.Validate(); err != nil {
+		return entities.ShortLink{}, utils.FormatValidationError(err, req)
+	}
+
+	var validationErrors []utils.FieldError
+	if req.Slug != "" && !slugPattern.MatchString(req.Slug) {
+		validationErrors = append(validationErrors, utils.FieldError{Field: "slug", Rule: "alphanum_dash_underscore"})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		validationErrors = append(validationErrors, utils.FieldError{Field: "expires_at", Rule: "future"})
+	}
+	if len(validationErrors) > 0 {
+		return entities.ShortLink{}, utils.ValidationError{Errors: validationErrors}
+	}
+
+	link := entities.ShortLink{TargetUrl: req.TargetUrl}
+	if req.ExpiresAt != nil {
+		// expires_at is a TIMESTAMP without time zone, an offset would be
+		// dropped rather than applied
+		expiresAt := req.ExpiresAt.UTC()
+		link.ExpiresAt = &expiresAt
+	}
+
+	if req.Slug != "" {
+		link.Code = req.Slug
+		if err := s.repo.CreateLink(ctx, s.db, &link); err != nil {
+			if errors.Is(err, repositories.ErrDuplicateCode) {
+				return entities.ShortLink{}, ErrLinkCodeTaken
+			}
+			return entities.ShortLink{}, err
+		}
+
+		link.ShortUrl = s.shortURL(link.Code)
+		return link, nil
+	}
+
+	for attempt := 0; attempt < codeAttempts; attempt++ {
+		code, err := randomCode()
+		if err != nil {
+			return entities.ShortLink{}, err
+		}
+
+		link.Code = code
+		err = s.repo.CreateLink(ctx, s.db, &link)
+		if errors.Is(err, repositories.ErrDuplicateCode) {
+			continue
+		}
+		if err != nil {
+			return entities.ShortLink{}, err
+		}
+
+		link.ShortUrl = s.shortURL(link.Code)
+		return link, nil
+	}
+
+	return entities.ShortLink{}, fmt.Errorf("unable to generate a unique code after %d attempts", codeAttempts)
+}
+
+// FollowLink returns the link behind code and counts the click. Only the
+// referrer host and the user agent family are kept.
+func (s *LinkService) FollowLink(ctx context.Context, code, referrer, userAgent string) (entities.ShortLink, error) {
+	link, err := s.repo.GetLinkByCode(ctx, s.db, code)
+	if err != nil {
+		return entities.ShortLink{}, err
+	}
+
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return entities.ShortLink{}, ErrLinkExpired
+	}
+
+	// a lost click must never break the redirect itself
+	if err := s.repo.RecordClick(ctx, s.db, link.ID, time.Now().UTC(), referrerHost(referrer), userAgentFamily(userAgent)); err != nil {
+		utils.LoggerFromContext(ctx).WithError(err).Warnf("failed to record click for link code:%s", code)
+	}
+
+	return link, nil
+}
+
+func (s *LinkService) GetLinkStats(ctx context.Context, code string) (entities.ShortLinkStats, error) {
+	link, err := s.repo.GetLinkByCode(ctx, s.db, code)
+	if err != nil {
+		return entities.ShortLinkStats{}, err
+	}
+
+	clicks, err := s.repo.GetLinkClicks(ctx, s.db, link.ID)
+	if err != nil {
+		return entities.ShortLinkStats{}, err
+	}
+
+	stats := entities.ShortLinkStats{Code: link.Code, Clicks: clicks}
+	for _, click := range clicks {
+		stats.TotalClicks += click.Clicks
+	}
+
+	return stats, nil
+}
+
+func (s *LinkService) shortURL(code string) string {
+	return s.baseURL + "/s/" + code
+}
+
+func randomCode() (string, error) {
+	max := big.NewInt(int64(len(codeAlphabet)))
+	code := make([]byte, codeLength)
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate code: %w", err)
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// userAgentFamily reduces a User-Agent header to a coarse browser family.
+// Order matters since most browsers also claim to be Safari or Chrome.
+func userAgentFamily(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider"):
+		return "bot"
+	case strings.Contains(ua, "edg/") || strings.Contains(ua, "edge/"):
+		return "edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		return "opera"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		return "firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		return "chrome"
+	case strings.Contains(ua, "safari/"):
+		return "safari"
+	case strings.HasPrefix(ua, "curl/"):
+		return "curl"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+type recordedClick struct {
+	linkID          int
+	referrerHost    string
+	userAgentFamily string
+}
+
+// fakeLinkRepo stores links like the short_links table: expires_at is a
+// TIMESTAMP, it keeps the wall clock of what it is given and drops the
+// offset.
+type fakeLinkRepo struct {
+	links     map[string]entities.ShortLink
+	clicks    []recordedClick
+	taken     int
+	clickFail bool
+}
+
+func newFakeLinkRepo() *fakeLinkRepo {
+	return &fakeLinkRepo{links: make(map[string]entities.ShortLink)}
+}
+
+func (r *fakeLinkRepo) CreateLink(ctx context.Context, db *sqlx.DB, link *entities.ShortLink) error {
+	if r.taken > 0 {
+		r.taken--
+		return repositories.ErrDuplicateCode
+	}
+	if _, ok := r.links[link.Code]; ok {
+		return repositories.ErrDuplicateCode
+	}
+
+	stored := *link
+	if link.ExpiresAt != nil {
+		wall := time.Date(link.ExpiresAt.Year(), link.ExpiresAt.Month(), link.ExpiresAt.Day(),
+			link.ExpiresAt.Hour(), link.ExpiresAt.Minute(), link.ExpiresAt.Second(), link.ExpiresAt.Nanosecond(), time.UTC)
+		stored.ExpiresAt = &wall
+	}
+	stored.ID = len(r.links) + 1
+	link.ID = stored.ID
+	r.links[link.Code] = stored
+	return nil
+}
+
+func (r *fakeLinkRepo) GetLinkByCode(ctx context.Context, db *sqlx.DB, code string) (entities.ShortLink, error) {
+	link, ok := r.links[code]
+	if !ok {
+		return entities.ShortLink{}, sql.ErrNoRows
+	}
+	return link, nil
+}
+
+func (r *fakeLinkRepo) RecordClick(ctx context.Context, db *sqlx.DB, linkID int, day time.Time, referrerHost, userAgentFamily string) error {
+	if r.clickFail {
+		return errors.New("database unavailable")
+	}
+	r.clicks = append(r.clicks, recordedClick{linkID, referrerHost, userAgentFamily})
+	return nil
+}
+
+func (r *fakeLinkRepo) GetLinkClicks(ctx context.Context, db *sqlx.DB, linkID int) ([]entities.LinkClickStat, error) {
+	var stats []entities.LinkClickStat
+	for _, click := range r.clicks {
+		if click.linkID == linkID {
+			stats = append(stats, entities.LinkClickStat{ReferrerHost: click.referrerHost, UserAgentFamily: click.userAgentFamily, Clicks: 1})
+		}
+	}
+	return stats, nil
+}
+
+func TestCreateLink(t *testing.T) {
+	repo := newFakeLinkRepo()
+	service := NewLinkService(repo, nil, "https://sho.rt/")
+
+	link, err := service.CreateLink(context.Background(), &entities.CreateShortLinkRequest{TargetUrl: "https://example.com/a", Slug: "clean-code"})
+	if err != nil {
+		t.Fatalf("CreateLink failed: %v", err)
+	}
+	if link.Code != "clean-code" || link.ShortUrl != "https://sho.rt/s/clean-code" {
+		t.Errorf("link = %+v", link)
+	}
+
+	_, err = service.CreateLink(context.Background(), &entities.CreateShortLinkRequest{TargetUrl: "https://example.com/b", Slug: "clean-code"})
+	if !errors.Is(err, ErrLinkCodeTaken) {
+		t.Errorf("taken slug: err = %v, want ErrLinkCodeTaken", err)
+	}
+
+	// random codes are retried when they collide
+	repo.taken = codeAttempts - 1
+	link, err = service.CreateLink(context.Background(), &entities.CreateShortLinkRequest{TargetUrl: "https://example.com/c"})
+	if err != nil || len(link.Code) != codeLength {
+		t.Errorf("generated link = %+v, %v", link, err)
+	}
+
+	repo.taken = codeAttempts
+	if _, err := service.CreateLink(context.Background(), &entities.CreateShortLinkRequest{TargetUrl: "https://example.com/d"}); err == nil {
+		t.Error("CreateLink succeeded although every code collided")
+	}
+}
+
+func TestCreateLinkValidation(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		req       entities.CreateShortLinkRequest
+		wantField string
+	}{
+		{name: "missing target", req: entities.CreateShortLinkRequest{}, wantField: "target_url"},
+		{name: "not http", req: entities.CreateShortLinkRequest{TargetUrl: "javascript:alert(1)"}, wantField: "target_url"},
+		{name: "slug characters", req: entities.CreateShortLinkRequest{TargetUrl: "https://example.com", Slug: "a/b/c"}, wantField: "slug"},
+		{name: "expiry in the past", req: entities.CreateShortLinkRequest{TargetUrl: "https://example.com", ExpiresAt: &past}, wantField: "expires_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewLinkService(newFakeLinkRepo(), nil, "").CreateLink(context.Background(), &tt.req)
+
+			var verr utils.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("err = %v, want a validation error", err)
+			}
+			if len(verr.Errors) != 1 || verr.Errors[0].Field != tt.wantField {
+				t.Errorf("errors = %+v, want one on %s", verr.Errors, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestLinkExpiryKeepsTheInstant(t *testing.T) {
+	repo := newFakeLinkRepo()
+	service := NewLinkService(repo, nil, "")
+
+	// an hour from now written at UTC+7, stored without the offset it would
+	// already be 6 hours past
+	expiresAt := time.Now().Add(time.Hour).In(time.FixedZone("WIB", 7*60*60))
+	if _, err := service.CreateLink(context.Background(), &entities.CreateShortLinkRequest{TargetUrl: "https://example.com", Slug: "soon", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := service.FollowLink(context.Background(), "soon", "", "")
+	if err != nil {
+		t.Fatalf("FollowLink failed: %v", err)
+	}
+	if !link.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires at %s, want %s", link.ExpiresAt, expiresAt)
+	}
+}
+
+func TestFollowLink(t *testing.T) {
+	repo := newFakeLinkRepo()
+	service := NewLinkService(repo, nil, "")
+	expired := time.Now().Add(-time.Minute).UTC()
+	repo.links["old"] = entities.ShortLink{ID: 1, Code: "old", TargetUrl: "https://example.com/old", ExpiresAt: &expired}
+	repo.links["book"] = entities.ShortLink{ID: 2, Code: "book", TargetUrl: "https://example.com/book"}
+
+	if _, err := service.FollowLink(context.Background(), "old", "", ""); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("expired link: err = %v, want ErrLinkExpired", err)
+	}
+	if _, err := service.FollowLink(context.Background(), "missing", "", ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown code: err = %v, want sql.ErrNoRows", err)
+	}
+
+	chrome := "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	link, err := service.FollowLink(context.Background(), "book", "https://News.Example.org/post?id=1", chrome)
+	if err != nil || link.TargetUrl != "https://example.com/book" {
+		t.Fatalf("FollowLink = %+v, %v", link, err)
+	}
+	if len(repo.clicks) != 1 || repo.clicks[0] != (recordedClick{2, "news.example.org", "chrome"}) {
+		t.Errorf("clicks = %+v, want one chrome click from news.example.org", repo.clicks)
+	}
+
+	// a lost click doesn't break the redirect
+	repo.clickFail = true
+	if _, err := service.FollowLink(context.Background(), "book", "", "curl/8.0"); err != nil {
+		t.Errorf("FollowLink with a failing click store = %v", err)
+	}
+
+	repo.clickFail = false
+	service.FollowLink(context.Background(), "book", "", "Googlebot/2.1")
+	stats, err := service.GetLinkStats(context.Background(), "book")
+	if err != nil || stats.TotalClicks != 2 || len(stats.Clicks) != 2 {
+		t.Errorf("stats = %+v, %v, want 2 clicks", stats, err)
+	}
+}
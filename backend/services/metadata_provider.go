@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+)
+
+// maxCachedMetadata bounds the lookup cache, expired entries only go
+// away when swept so distinct ISBNs would otherwise pile up.
+const maxCachedMetadata = 10000
+
+var (
+	ErrMetadataNotFound    = errors.New("no metadata found for isbn")
+	ErrMetadataUnavailable = errors.New("metadata provider unavailable")
+)
+
+// MetadataProvider looks up bibliographic details for a book by its ISBN.
+type MetadataProvider interface {
+	LookupByIsbn(ctx context.Context, isbn string) (entities.Book, error)
+}
+
+type cachedMetadata struct {
+	book      entities.Book
+	err       error
+	expiresAt time.Time
+}
+
+// OpenLibraryProvider talks to the Open Library books API, or any server
+// exposing the same /api/books contract.
+type OpenLibraryProvider struct {
+	baseURL  string
+	client   *http.Client
+	cacheTTL time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]cachedMetadata
+	cacheSize int
+	sweptAt   time.Time
+}
+
+func NewOpenLibraryProvider(baseURL string, timeout, cacheTTL time.Duration) MetadataProvider {
+	return &OpenLibraryProvider{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		client:    &http.Client{Timeout: timeout},
+		cacheTTL:  cacheTTL,
+		cache:     make(map[string]cachedMetadata),
+		cacheSize: maxCachedMetadata,
+		sweptAt:   time.Now(),
+	}
+}
+
+type openLibraryBook struct {
+	Title         string `json:"title"`
+	Subtitle      string `json:"subtitle"`
+	NumberOfPages int    `json:"number_of_pages"`
+	PublishDate   string `json:"publish_date"`
+	Authors       []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Cover struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+	Excerpts []struct {
+		Text string `json:"text"`
+	} `json:"excerpts"`
+}
+
+func (p *OpenLibraryProvider) LookupByIsbn(ctx context.Context, isbn string) (entities.Book, error) {
+	if cached, ok := p.fromCache(isbn); ok {
+		return cached.book, cached.err
+	}
+
+	book, err := p.fetch(ctx, isbn)
+
+	// only definitive answers are cached, transient failures are retried
+	if err == nil || errors.Is(err, ErrMetadataNotFound) {
+		p.store(isbn, cachedMetadata{book: book, err: err, expiresAt: time.Now().Add(p.cacheTTL)})
+	}
+
+	return book, err
+}
+
+// store caches an answer. Expired entries are swept once per TTL, and when
+// the cache is still full arbitrary entries make room for the new one.
+func (p *OpenLibraryProvider) store(isbn string, entry cachedMetadata) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.sweptAt) >= p.cacheTTL || len(p.cache) >= p.cacheSize {
+		for key, cached := range p.cache {
+			if now.After(cached.expiresAt) {
+				delete(p.cache, key)
+			}
+		}
+		p.sweptAt = now
+	}
+	for key := range p.cache {
+		if len(p.cache) < p.cacheSize {
+			break
+		}
+		delete(p.cache, key)
+	}
+
+	p.cache[isbn] = entry
+}
+
+func (p *OpenLibraryProvider) fromCache(isbn string) (cachedMetadata, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cached, ok := p.cache[isbn]
+	if !ok {
+		return cachedMetadata{}, false
+	}
+
+	if time.Now().After(cached.expiresAt) {
+		delete(p.cache, isbn)
+		return cachedMetadata{}, false
+	}
+
+	return cached, true
+}
+
+func (p *OpenLibraryProvider) fetch(ctx context.Context, isbn string) (entities.Book, error) {
+	bibkey := "ISBN:" + isbn
+
+	query := url.Values{}
+	query.Set("bibkeys", bibkey)
+	query.Set("format", "json")
+	query.Set("jscmd", "data")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return entities.Book{}, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return entities.Book{}, fmt.Errorf("%w: %w", ErrMetadataUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return entities.Book{}, fmt.Errorf("%w: unexpected status %d", ErrMetadataUnavailable, resp.StatusCode)
+	}
+
+	var payload map[string]openLibraryBook
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return entities.Book{}, fmt.Errorf("%w: invalid response: %v", ErrMetadataUnavailable, err)
+	}
+
+	data, ok := payload[bibkey]
+	if !ok {
+		return entities.Book{}, ErrMetadataNotFound
+	}
+
+	book := entities.Book{
+		Title:           data.Title,
+		NumberOfPages:   data.NumberOfPages,
+		PublicationDate: parsePublishDate(data.PublishDate),
+		Isbn:            isbn,
+	}
+
+	if data.Subtitle != "" {
+		book.Title = truncate(data.Title+": "+data.Subtitle, 255)
+	}
+
+	authors := make([]string, 0, len(data.Authors))
+	for _, author := range data.Authors {
+		authors = append(authors, author.Name)
+	}
+	book.Author = strings.Join(authors, ", ")
+
+	switch {
+	case data.Cover.Large != "":
+		book.CoverImageUrl = data.Cover.Large
+	case data.Cover.Medium != "":
+		book.CoverImageUrl = data.Cover.Medium
+	case data.Cover.Small != "":
+		book.CoverImageUrl = data.Cover.Small
+	}
+
+	if len(data.Excerpts) > 0 {
+		book.Description = truncate(data.Excerpts[0].Text, 1000)
+	}
+
+	return book, nil
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+
+	return string(runes[:max])
+}
+
+var publishDateLayouts = []string{
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"January 2006",
+	"Jan 2006",
+	"2006",
+}
+
+// parsePublishDate converts the free-form dates Open Library returns into
+// the YYYY-MM-DD format used by books, or "" when it can't be understood.
+func parsePublishDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range publishDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+
+	return ""
+}
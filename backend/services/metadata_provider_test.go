@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const openLibraryResponse = `{
+	"ISBN:9780140328721": {
+		"title": "Fantastic Mr Fox",
+		"number_of_pages": 96,
+		"publish_date": "October 1, 1988",
+		"authors": [{"name": "Roald Dahl"}],
+		"cover": {"medium": "https://covers.openlibrary.org/b/id/8739161-M.jpg"},
+		"excerpts": [{"text": "And these two very old people..."}]
+	}
+}`
+
+// newTestLibrary serves the Open Library contract, knowing a single ISBN,
+// and counts the requests it gets.
+func newTestLibrary(t *testing.T, delay time.Duration) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("bibkeys") == "ISBN:9780140328721" {
+			w.Write([]byte(openLibraryResponse))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestOpenLibraryProviderFound(t *testing.T) {
+	server, _ := newTestLibrary(t, 0)
+	provider := NewOpenLibraryProvider(server.URL, time.Second, time.Hour)
+
+	book, err := provider.LookupByIsbn(context.Background(), "9780140328721")
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+
+	if book.Title != "Fantastic Mr Fox" || book.Author != "Roald Dahl" || book.NumberOfPages != 96 {
+		t.Errorf("unexpected book %+v", book)
+	}
+	if book.PublicationDate != "1988-10-01" {
+		t.Errorf("publication date = %q, want 1988-10-01", book.PublicationDate)
+	}
+	if book.CoverImageUrl != "https://covers.openlibrary.org/b/id/8739161-M.jpg" {
+		t.Errorf("cover = %q", book.CoverImageUrl)
+	}
+	if book.Isbn != "9780140328721" {
+		t.Errorf("isbn = %q", book.Isbn)
+	}
+}
+
+func TestOpenLibraryProviderNotFound(t *testing.T) {
+	server, _ := newTestLibrary(t, 0)
+	provider := NewOpenLibraryProvider(server.URL, time.Second, time.Hour)
+
+	_, err := provider.LookupByIsbn(context.Background(), "9780000000002")
+	if !errors.Is(err, ErrMetadataNotFound) {
+		t.Fatalf("err = %v, want ErrMetadataNotFound", err)
+	}
+}
+
+func TestOpenLibraryProviderTimeout(t *testing.T) {
+	server, requests := newTestLibrary(t, time.Second)
+	provider := NewOpenLibraryProvider(server.URL, 50*time.Millisecond, time.Hour)
+
+	_, err := provider.LookupByIsbn(context.Background(), "9780140328721")
+	if !errors.Is(err, ErrMetadataUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrMetadataUnavailable wrapping the deadline", err)
+	}
+
+	// transient failures aren't cached
+	provider.LookupByIsbn(context.Background(), "9780140328721")
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestOpenLibraryProviderCacheHit(t *testing.T) {
+	server, requests := newTestLibrary(t, 0)
+	provider := NewOpenLibraryProvider(server.URL, time.Second, time.Hour)
+
+	for _, isbn := range []string{"9780140328721", "9780140328721", "9780000000002", "9780000000002"} {
+		provider.LookupByIsbn(context.Background(), isbn)
+	}
+
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("requests = %d, want 2 as found and not found answers are cached", got)
+	}
+}
+
+func TestOpenLibraryProviderCacheBounded(t *testing.T) {
+	server, _ := newTestLibrary(t, 0)
+	provider := NewOpenLibraryProvider(server.URL, time.Second, time.Hour).(*OpenLibraryProvider)
+	provider.cacheSize = 3
+
+	for _, isbn := range []string{"9780000000001", "9780000000002", "9780000000003", "9780000000004", "9780000000005"} {
+		provider.LookupByIsbn(context.Background(), isbn)
+	}
+	if got := len(provider.cache); got != 3 {
+		t.Errorf("cache holds %d entries, want 3", got)
+	}
+
+	// expired entries are swept on the next store
+	provider.cacheTTL = time.Millisecond
+	provider.cache = make(map[string]cachedMetadata)
+	provider.LookupByIsbn(context.Background(), "9780000000001")
+	provider.LookupByIsbn(context.Background(), "9780000000002")
+	time.Sleep(5 * time.Millisecond)
+	provider.LookupByIsbn(context.Background(), "9780000000003")
+	if got := len(provider.cache); got != 1 {
+		t.Errorf("cache holds %d entries after the sweep, want 1", got)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedBookService struct {
+	inner BookServiceInterface
+}
+
+// NewTracedBookService records a span around every call of inner, between
+// the request span and the spans of the queries it runs.
+func NewTracedBookService(inner BookServiceInterface) BookServiceInterface {
+	return &tracedBookService{inner: inner}
+}
+
+func (s *tracedBookService) GetBooks(ctx context.Context) ([]entities.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetBooks")
+	books, err := s.inner.GetBooks(ctx)
+	span.SetAttributes(attribute.Int("books.count", len(books)))
+	tracing.End(span, err)
+	return books, err
+}
+
+func (s *tracedBookService) AddBook(ctx context.Context, book *entities.Book, opts AddBookOptions) error {
+	ctx, span := tracing.Start(ctx, "BookService.AddBook", trace.WithAttributes(attribute.Bool("books.autofill", opts.Autofill)))
+	err := s.inner.AddBook(ctx, book, opts)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedBookService) LookupBook(ctx context.Context, isbn string) (entities.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.LookupBook", trace.WithAttributes(attribute.String("books.isbn", isbn)))
+	book, err := s.inner.LookupBook(ctx, isbn)
+	tracing.End(span, err)
+	return book, err
+}
+
+func (s *tracedBookService) GetBookById(ctx context.Context, id string) (entities.Book, error) {
+	ctx, span := tracing.Start(ctx, "BookService.GetBookById", trace.WithAttributes(attribute.String("books.id", id)))
+	book, err := s.inner.GetBookById(ctx, id)
+	tracing.End(span, err)
+	return book, err
+}
+
+func (s *tracedBookService) UpdateBook(ctx context.Context, id string, book *entities.Book) error {
+	ctx, span := tracing.Start(ctx, "BookService.UpdateBook", trace.WithAttributes(attribute.String("books.id", id)))
+	err := s.inner.UpdateBook(ctx, id, book)
+	tracing.End(span, err)
+	return err
+}
+
+func (s *tracedBookService) DeleteBook(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "BookService.DeleteBook", trace.WithAttributes(attribute.String("books.id", id)))
+	err := s.inner.DeleteBook(ctx, id)
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/utils"
+)
+
+// maxBatchLine bounds a single NDJSON line.
+const maxBatchLine = 64 * 1024
+
+// ErrBatchInput reports a stream whose input couldn't be read to the end,
+// the items read before were processed.
+var ErrBatchInput = errors.New("unable to read the batch input")
+
+// ErrBatchTooLarge reports a batch with more items than allowed, a stream
+// stops there after processing the items before.
+var ErrBatchTooLarge = errors.New("batch too large")
+
+// urlBatchItem is one decoded input, err is set when it could not be read.
+type urlBatchItem struct {
+	req entities.URLRequest
+	err error
+}
+
+type urlBatchJob struct {
+	urlBatchItem
+	index  int
+	result chan entities.URLBatchResult
+}
+
+// UrlBatchProcessor runs many URL requests through a UrlService with a
+// bounded number of workers, reporting a result per item.
+type UrlBatchProcessor struct {
+	service UrlServiceInterface
+	workers int
+}
+
+func NewUrlBatchProcessor(service UrlServiceInterface, workers int) *UrlBatchProcessor {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	return &UrlBatchProcessor{service: service, workers: workers}
+}
+
+// ProcessBatch processes every request and returns results in input order.
+func (p *UrlBatchProcessor) ProcessBatch(ctx context.Context, reqs []entities.URLRequest) []entities.URLBatchResult {
+	results := make([]entities.URLBatchResult, 0, len(reqs))
+
+	i := 0
+	next := func() (urlBatchItem, bool) {
+		if i >= len(reqs) {
+			return urlBatchItem{}, false
+		}
+		i++
+		return urlBatchItem{req: reqs[i-1]}, true
+	}
+
+	_ = p.run(ctx, next, func(result entities.URLBatchResult) error {
+		results = append(results, result)
+		return nil
+	})
+
+	return results
+}
+
+// ProcessStream reads newline delimited JSON requests from r and emits a
+// result for each line, in input order, as soon as it is ready. Lines that
+// are not valid JSON produce an error result instead of aborting the stream.
+// Reading stops after maxItems requests, ErrBatchTooLarge is returned when
+// more follow.
+func (p *UrlBatchProcessor) ProcessStream(ctx context.Context, r io.Reader, maxItems int, emit func(entities.URLBatchResult) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxBatchLine)
+
+	// only touched by next, run returns after its last call
+	read, exceeded := 0, false
+	next := func() (urlBatchItem, bool) {
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if read == maxItems {
+				exceeded = true
+				return urlBatchItem{}, false
+			}
+			read++
+
+			var item urlBatchItem
+			if err := json.Unmarshal([]byte(line), &item.req); err != nil {
+				item.err = fmt.Errorf("invalid json: %w", err)
+			}
+			return item, true
+		}
+		return urlBatchItem{}, false
+	}
+
+	if err := p.run(ctx, next, emit); err != nil {
+		return err
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrBatchInput, err)
+	}
+	if exceeded {
+		return fmt.Errorf("%w: more than %d items", ErrBatchTooLarge, maxItems)
+	}
+	return nil
+}
+
+// run feeds items from next to the worker pool. A bounded queue of pending
+// results keeps the output ordered while limiting how far reading can run
+// ahead of writing.
+func (p *UrlBatchProcessor) run(ctx context.Context, next func() (urlBatchItem, bool), emit func(entities.URLBatchResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan urlBatchJob)
+	pending := make(chan chan entities.URLBatchResult, p.workers*2)
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job.result <- p.process(ctx, job)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+
+		for index := 0; ; index++ {
+			item, ok := next()
+			if !ok {
+				return
+			}
+
+			job := urlBatchJob{urlBatchItem: item, index: index, result: make(chan entities.URLBatchResult, 1)}
+			select {
+			case pending <- job.result:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var emitErr error
+	for result := range pending {
+		if emitErr != nil {
+			continue
+		}
+
+		select {
+		case res := <-result:
+			if err := emit(res); err != nil {
+				emitErr = err
+				cancel()
+			}
+		case <-ctx.Done():
+			emitErr = ctx.Err()
+		}
+	}
+
+	wg.Wait()
+	return emitErr
+}
+
+func (p *UrlBatchProcessor) process(ctx context.Context, job urlBatchJob) entities.URLBatchResult {
+	result := entities.URLBatchResult{
+		Index:     job.index,
+		URL:       job.req.URL,
+		Operation: job.req.Operation,
+	}
+
+	if job.err != nil {
+		result.Error = job.err.Error()
+		return result
+	}
+
+	if err := p.service.ValidateRequest(job.req); err != nil {
+		result.Error = describeValidationError(err)
+		return result
+	}
+
+	processed, err := p.service.ProcessUrl(ctx, job.req.URL, job.req.Operation)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.ProcessedURL = processed
+	return result
+}
+
+func describeValidationError(err error) string {
+	verr, ok := err.(utils.ValidationError)
+	if !ok {
+		return err.Error()
+	}
+
+	fields := make([]string, 0, len(verr.Errors))
+	for _, field := range verr.Errors {
+		fields = append(fields, fmt.Sprintf("%s (%s)", field.Field, field.Rule))
+	}
+
+	return "validation failed: " + strings.Join(fields, ", ")
+}
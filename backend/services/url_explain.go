@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+)
+
+// Trace collects, for one explain request, the URL after every operation
+// and the rules that touched each component. A nil *Trace records nothing so
+// operations can call it unconditionally.
+type Trace struct {
+	steps []entities.URLExplainStep
+	rules map[string][]string
+}
+
+func NewTrace() *Trace {
+	return &Trace{}
+}
+
+// Rule notes that rule was applied to component during the current step.
+// Components are scheme, host, path, query, fragment or query:<key> for a
+// single parameter.
+func (t *Trace) Rule(component, rule string) {
+	if t == nil {
+		return
+	}
+
+	if t.rules == nil {
+		t.rules = make(map[string][]string)
+	}
+	t.rules[component] = append(t.rules[component], rule)
+}
+
+func (t *Trace) Steps() []entities.URLExplainStep {
+	if t == nil {
+		return nil
+	}
+
+	return t.steps
+}
+
+// applyTraced runs op and records it as one step, pipelines record their
+// own steps instead of appearing as a single one.
+func applyTraced(ctx context.Context, op UrlOperation, u *url.URL, trace *Trace) (*url.URL, error) {
+	if _, ok := op.(*pipelineOperation); ok || trace == nil {
+		return op.Apply(ctx, u, trace)
+	}
+
+	trace.rules = nil
+	out, err := op.Apply(ctx, u, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	trace.steps = append(trace.steps, entities.URLExplainStep{
+		Operation: op.Name(),
+		Input:     u.String(),
+		Output:    out.String(),
+		Changes:   trace.diff(op.Name(), u, out),
+	})
+	return out, nil
+}
+
+// diff lists the components that differ between before and after, a change
+// no rule claimed is attributed to the operation itself.
+func (t *Trace) diff(operation string, before, after *url.URL) []entities.URLComponentChange {
+	var changes []entities.URLComponentChange
+	add := func(component, from, to string, fallbacks ...string) {
+		if from == to {
+			return
+		}
+
+		rule := operation
+		for _, key := range append([]string{component}, fallbacks...) {
+			if rules := t.rules[key]; len(rules) > 0 {
+				rule = strings.Join(rules, "; ")
+				break
+			}
+		}
+
+		changes = append(changes, entities.URLComponentChange{Component: component, Before: from, After: to, Rule: rule})
+	}
+
+	add("scheme", before.Scheme, after.Scheme)
+	add("host", before.Host, after.Host)
+	add("path", before.EscapedPath(), after.EscapedPath())
+
+	beforeParams, afterParams := queryParams(before.RawQuery), queryParams(after.RawQuery)
+	keys := make([]string, 0, len(beforeParams)+len(afterParams))
+	for key := range beforeParams {
+		keys = append(keys, key)
+	}
+	for key := range afterParams {
+		if _, ok := beforeParams[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	keyChanged := false
+	for _, key := range keys {
+		from, to := strings.Join(beforeParams[key], "&"), strings.Join(afterParams[key], "&")
+		if from != to {
+			keyChanged = true
+			add("query:"+key, from, to, "query")
+		}
+	}
+	// parameters only moved around, report the query as a whole
+	if !keyChanged {
+		add("query", before.RawQuery, after.RawQuery)
+	}
+
+	add("fragment", before.EscapedFragment(), after.EscapedFragment())
+
+	return changes
+}
+
+// queryParams groups the raw key=value pairs of a query by key, keeping
+// their order.
+func queryParams(rawQuery string) map[string][]string {
+	params := make(map[string][]string)
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params[queryKey(param)] = append(params[queryKey(param)], param)
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// normalizeURL applies the RFC 3986 section 6 normalizations so that
+// equivalent URLs compare equal: case folding, default port removal,
+// percent-encoding and dot-segment normalization, IDN to punycode, sorted
+// query parameters and removal of an empty query or fragment.
+func normalizeURL(u *url.URL) (*url.URL, error) {
+	out := *u
+	out.Scheme = strings.ToLower(out.Scheme)
+
+	if out.Host != "" {
+		host, err := normalizeHost(out.Scheme, out.Host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+		}
+		out.Host = host
+	}
+
+	path := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	if path == "" && out.Host != "" {
+		path = "/"
+	}
+	if err := setEscapedPath(&out, path); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	out.RawQuery = normalizeQuery(u.RawQuery)
+	out.ForceQuery = false
+
+	fragment := normalizePercentEncoding(u.EscapedFragment())
+	if fragment == "" {
+		out.Fragment, out.RawFragment = "", ""
+	} else if err := setEscapedFragment(&out, fragment); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	return &out, nil
+}
+
+func normalizeHost(scheme, host string) (string, error) {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	// IPv6 literals are kept as they are, everything else goes through IDNA
+	if !strings.Contains(hostname, ":") {
+		ascii, err := idna.Lookup.ToASCII(hostname)
+		if err != nil {
+			return "", fmt.Errorf("invalid host %q: %w", hostname, err)
+		}
+		hostname = ascii
+	}
+
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+
+	if strings.Contains(hostname, ":") {
+		hostname = "[" + hostname + "]"
+	}
+
+	if port == "" {
+		return hostname, nil
+	}
+
+	return hostname + ":" + port, nil
+}
+
+// normalizeQuery sorts the parameters by key, keeping the relative order of
+// repeated keys, and drops empty pairs.
+func normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params = append(params, normalizePercentEncoding(param))
+		}
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return queryKey(params[i]) < queryKey(params[j])
+	})
+
+	return strings.Join(params, "&")
+}
+
+func queryKey(param string) string {
+	key, _, _ := strings.Cut(param, "=")
+	return key
+}
+
+func isUnreserved(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// normalizePercentEncoding decodes percent-encoded unreserved characters
+// and uppercases the hex digits of every remaining escape.
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(strings.ToUpper(s[i : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// removeDotSegments implements the algorithm of RFC 3986 section 5.2.4.
+func removeDotSegments(path string) string {
+	var out []string
+	input := path
+
+	for input != "" {
+		switch {
+		case strings.HasPrefix(input, "../"):
+			input = input[3:]
+		case strings.HasPrefix(input, "./"):
+			input = input[2:]
+		case strings.HasPrefix(input, "/./"):
+			input = input[2:]
+		case input == "/.":
+			input = "/"
+		case strings.HasPrefix(input, "/../"):
+			input = input[3:]
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		case input == "/..":
+			input = "/"
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		case input == "." || input == "..":
+			input = ""
+		default:
+			start := 0
+			if input[0] == '/' {
+				start = 1
+			}
+			end := strings.IndexByte(input[start:], '/')
+			if end == -1 {
+				end = len(input)
+			} else {
+				end += start
+			}
+			out = append(out, input[:end])
+			input = input[end:]
+		}
+	}
+
+	return strings.Join(out, "")
+}
+
+func setEscapedPath(u *url.URL, escaped string) error {
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+
+	u.Path = path
+	u.RawPath = escaped
+	return nil
+}
+
+func setEscapedFragment(u *url.URL, escaped string) error {
+	fragment, err := url.PathUnescape(escaped)
+	if err != nil {
+		return fmt.Errorf("invalid fragment: %w", err)
+	}
+
+	u.Fragment = fragment
+	u.RawFragment = escaped
+	return nil
+}
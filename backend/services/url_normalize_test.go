@@ -0,0 +1,83 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "case folding", in: "HTTP://Example.COM/Path", want: "http://example.com/Path"},
+		{name: "default http port", in: "http://example.com:80/", want: "http://example.com/"},
+		{name: "default https port", in: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "other port kept", in: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "empty path", in: "https://example.com", want: "https://example.com/"},
+		{name: "trailing dot of the host", in: "https://example.com./a", want: "https://example.com/a"},
+		{name: "unreserved escapes decoded", in: "https://example.com/%7Euser/%61", want: "https://example.com/~user/a"},
+		{name: "reserved escapes uppercased", in: "https://example.com/a%2fb?q=%3a", want: "https://example.com/a%2Fb?q=%3A"},
+		{name: "dot segments", in: "https://example.com/a/./b/../c/", want: "https://example.com/a/c/"},
+		{name: "dot segments above the root", in: "https://example.com/../../a", want: "https://example.com/a"},
+		{name: "sorted query keeping repeated keys in order", in: "https://example.com/?b=2&a=1&b=1", want: "https://example.com/?a=1&b=2&b=1"},
+		{name: "empty query pairs dropped", in: "https://example.com/?&a=1&&", want: "https://example.com/?a=1"},
+		{name: "empty query and fragment", in: "https://example.com/a?#", want: "https://example.com/a"},
+		{name: "fragment kept", in: "https://example.com/a#Top", want: "https://example.com/a#Top"},
+		{name: "internationalized host", in: "https://Bücher.example/", want: "https://xn--bcher-kva.example/"},
+		{name: "ipv6 literal", in: "http://[2001:DB8::1]:80/", want: "http://[2001:db8::1]/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := normalizeURL(u)
+			if err != nil {
+				t.Fatalf("normalizeURL(%s) failed: %v", tt.in, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("normalizeURL(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeURLIsIdempotent(t *testing.T) {
+	u, _ := url.Parse("HTTPS://Bücher.Example:443/a/../%7eb/?z=1&a=%2f#x")
+
+	once, err := normalizeURL(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := normalizeURL(once)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if once.String() != twice.String() {
+		t.Errorf("normalizing again changed %s into %s", once, twice)
+	}
+}
+
+func TestRemoveDotSegments(t *testing.T) {
+	// the examples of RFC 3986 section 5.2.4
+	tests := map[string]string{
+		"/a/b/c/./../../g":   "/a/g",
+		"mid/content=5/../6": "mid/6",
+		"/.":                 "/",
+		"/a/..":              "/",
+		"../a":               "a",
+		"":                   "",
+	}
+
+	for in, want := range tests {
+		if got := removeDotSegments(in); got != want {
+			t.Errorf("removeDotSegments(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/goesbams/mini-books-library/backend/entities"
+)
+
+// UrlOperation is a single URL transformation that can be requested by
+// name or composed into a pipeline.
+type UrlOperation interface {
+	Name() string
+	Description() string
+	// Apply returns the transformed URL, trace may be nil and is only set
+	// when the caller asked for an explanation.
+	Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error)
+}
+
+// OperationRegistry holds the available operations by name. It is built at
+// startup and only read afterwards.
+type OperationRegistry struct {
+	operations map[string]UrlOperation
+}
+
+func NewOperationRegistry() *OperationRegistry {
+	return &OperationRegistry{operations: make(map[string]UrlOperation)}
+}
+
+func (r *OperationRegistry) Register(op UrlOperation) error {
+	if op.Name() == "" || strings.ContainsAny(op.Name(), " \t") {
+		return fmt.Errorf("invalid operation name %q", op.Name())
+	}
+
+	if _, exists := r.operations[op.Name()]; exists {
+		return fmt.Errorf("operation %q is already registered", op.Name())
+	}
+
+	r.operations[op.Name()] = op
+	return nil
+}
+
+// RegisterPipelines adds every configured pipeline, steps must name
+// operations registered beforehand.
+func (r *OperationRegistry) RegisterPipelines(pipelines map[string]config.PipelineConfig) error {
+	names := make([]string, 0, len(pipelines))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := pipelines[name]
+		if len(cfg.Steps) == 0 {
+			return fmt.Errorf("pipeline %q has no steps", name)
+		}
+
+		pipeline := &pipelineOperation{name: name, description: cfg.Description}
+		for _, step := range cfg.Steps {
+			op, ok := r.operations[step]
+			if !ok {
+				return fmt.Errorf("pipeline %q: unknown operation %q", name, step)
+			}
+			pipeline.steps = append(pipeline.steps, op)
+		}
+
+		if err := r.Register(pipeline); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OperationRegistry) Get(name string) (UrlOperation, bool) {
+	op, ok := r.operations[name]
+	return op, ok
+}
+
+// List describes every registered operation sorted by name.
+func (r *OperationRegistry) List() []entities.URLOperationInfo {
+	infos := make([]entities.URLOperationInfo, 0, len(r.operations))
+	for _, op := range r.operations {
+		info := entities.URLOperationInfo{Name: op.Name(), Description: op.Description()}
+		if pipeline, ok := op.(*pipelineOperation); ok {
+			for _, step := range pipeline.steps {
+				info.Steps = append(info.Steps, step.Name())
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// RegisterValidation adds the "url_operation" validator tag, which only
+// accepts names present in the registry.
+func (r *OperationRegistry) RegisterValidation(validate *validator.Validate) error {
+	return validate.RegisterValidation("url_operation", func(fl validator.FieldLevel) bool {
+		_, ok := r.Get(fl.Field().String())
+		return ok
+	})
+}
+
+type pipelineOperation struct {
+	name        string
+	description string
+	steps       []UrlOperation
+}
+
+func (p *pipelineOperation) Name() string { return p.name }
+
+func (p *pipelineOperation) Description() string {
+	if p.description != "" {
+		return p.description
+	}
+
+	names := make([]string, 0, len(p.steps))
+	for _, step := range p.steps {
+		names = append(names, step.Name())
+	}
+	return "Pipeline: " + strings.Join(names, " → ")
+}
+
+func (p *pipelineOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	var err error
+	for _, step := range p.steps {
+		if u, err = applyTraced(ctx, step, u, trace); err != nil {
+			return nil, fmt.Errorf("%s: %w", step.Name(), err)
+		}
+	}
+
+	return u, nil
+}
+
+type canonicalOperation struct{}
+
+func (canonicalOperation) Name() string { return "canonical" }
+
+func (canonicalOperation) Description() string {
+	return "Remove the query string and a trailing slash"
+}
+
+func (canonicalOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	trace.Rule("query", "canonical drops the query string")
+	trace.Rule("path", "canonical trims a trailing slash")
+
+	out := *u
+	out.RawQuery = ""
+	out.ForceQuery = false
+	out.Path = strings.TrimSuffix(out.Path, "/")
+	out.RawPath = strings.TrimSuffix(out.RawPath, "/")
+	return &out, nil
+}
+
+type redirectOperation struct {
+	redirector *Redirector
+}
+
+func (redirectOperation) Name() string { return "redirection" }
+
+func (redirectOperation) Description() string {
+	return "Apply the configured host mappings, scheme, path rewrites and lowercasing"
+}
+
+func (o redirectOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	return o.redirector.Apply(u, trace), nil
+}
+
+type normalizeOperation struct{}
+
+func (normalizeOperation) Name() string { return "normalize" }
+
+func (normalizeOperation) Description() string {
+	return "RFC 3986 normalization: case, default port, dot segments, percent-encoding, punycode and sorted query"
+}
+
+func (normalizeOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	trace.Rule("scheme", "RFC 3986 case normalization")
+	trace.Rule("host", "RFC 3986 case, default port and IDNA normalization")
+	trace.Rule("path", "RFC 3986 dot-segment and percent-encoding normalization")
+	trace.Rule("query", "RFC 3986 percent-encoding normalization and sorted parameters")
+	trace.Rule("fragment", "RFC 3986 percent-encoding normalization")
+
+	return normalizeURL(u)
+}
+
+type stripTrackingOperation struct {
+	tracking *TrackingStripper
+}
+
+func (stripTrackingOperation) Name() string { return "strip-tracking" }
+
+func (stripTrackingOperation) Description() string {
+	return "Remove tracking parameters from the configured deny-list and keep meaningful ones"
+}
+
+func (o stripTrackingOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	return o.tracking.Apply(u, trace), nil
+}
+
+type resolveOperation struct {
+	resolver *Resolver
+}
+
+func (resolveOperation) Name() string { return "resolve" }
+
+func (resolveOperation) Description() string {
+	return "Follow live HTTP redirects and canonical links to the final URL"
+}
+
+func (o resolveOperation) Apply(ctx context.Context, u *url.URL, trace *Trace) (*url.URL, error) {
+	resolution, err := o.resolver.Resolve(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	rule := fmt.Sprintf("followed %d hop(s) to the live destination", len(resolution.Hops))
+	for _, component := range []string{"scheme", "host", "path", "query", "fragment"} {
+		trace.Rule(component, rule)
+	}
+
+	return url.Parse(resolution.FinalURL)
+}
+
+// NewDefaultOperationRegistry registers the built-in operations followed by
+// the configured pipelines.
+func NewDefaultOperationRegistry(redirector *Redirector, tracking *TrackingStripper, resolver *Resolver, pipelines map[string]config.PipelineConfig) (*OperationRegistry, error) {
+	registry := NewOperationRegistry()
+
+	for _, op := range []UrlOperation{
+		canonicalOperation{},
+		redirectOperation{redirector: redirector},
+		normalizeOperation{},
+		stripTrackingOperation{tracking: tracking},
+		resolveOperation{resolver: resolver},
+	} {
+		if err := registry.Register(op); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := registry.RegisterPipelines(pipelines); err != nil {
+		return nil, err
+	}
+
+	return registry, nil
+}
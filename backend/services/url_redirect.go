@@ -0,0 +1,176 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]+)?$`)
+
+type regexRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Redirector applies the configured redirection rules to a URL.
+type Redirector struct {
+	exactHosts    map[string]string
+	wildcardHosts map[string]string
+	defaultHost   string
+	scheme        string
+	prefixes      []config.PathPrefixRewrite
+	regexes       []regexRewrite
+	lowercase     config.LowercaseComponents
+}
+
+// NewRedirector validates the rules and compiles them, it fails on the first
+// invalid rule so misconfiguration is caught at startup.
+func NewRedirector(cfg config.RedirectConfig) (*Redirector, error) {
+	r := &Redirector{
+		exactHosts:    make(map[string]string),
+		wildcardHosts: make(map[string]string),
+		lowercase:     cfg.Lowercase,
+	}
+
+	for source, target := range cfg.HostMappings {
+		source = strings.ToLower(strings.TrimSpace(source))
+		target = strings.ToLower(strings.TrimSpace(target))
+
+		if !hostnamePattern.MatchString(target) {
+			return nil, fmt.Errorf("redirect host mapping %q: invalid target host %q", source, target)
+		}
+
+		switch {
+		case source == "*":
+			r.defaultHost = target
+		case strings.HasPrefix(source, "*."):
+			if !hostnamePattern.MatchString(source[2:]) {
+				return nil, fmt.Errorf("redirect host mapping: invalid source pattern %q", source)
+			}
+			r.wildcardHosts[source[1:]] = target
+		case hostnamePattern.MatchString(source):
+			r.exactHosts[source] = target
+		default:
+			return nil, fmt.Errorf("redirect host mapping: invalid source host %q", source)
+		}
+	}
+
+	switch cfg.Scheme {
+	case "", "http", "https":
+		r.scheme = cfg.Scheme
+	default:
+		return nil, fmt.Errorf("redirect scheme must be http or https, got %q", cfg.Scheme)
+	}
+
+	for i, rewrite := range cfg.PathPrefixRewrites {
+		if !strings.HasPrefix(rewrite.From, "/") || !strings.HasPrefix(rewrite.To, "/") {
+			return nil, fmt.Errorf("path prefix rewrite #%d: from and to must start with /", i+1)
+		}
+		r.prefixes = append(r.prefixes, rewrite)
+	}
+
+	for i, rewrite := range cfg.RegexRewrites {
+		pattern, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("regex rewrite #%d: %w", i+1, err)
+		}
+		r.regexes = append(r.regexes, regexRewrite{pattern: pattern, replacement: rewrite.Replacement})
+	}
+
+	return r, nil
+}
+
+// Apply returns a redirected copy of u, recording the rules it applies on
+// trace when one is given.
+func (r *Redirector) Apply(u *url.URL, trace *Trace) *url.URL {
+	out := *u
+
+	if lower := strings.ToLower(out.Scheme); lower != out.Scheme {
+		out.Scheme = lower
+		trace.Rule("scheme", "lowercase scheme")
+	}
+	if lower := strings.ToLower(out.Host); lower != out.Host {
+		out.Host = lower
+		trace.Rule("host", "lowercase host")
+	}
+
+	if target, source, ok := r.mapHost(out.Host, out.Hostname()); ok && target != out.Host {
+		out.Host = target
+		trace.Rule("host", fmt.Sprintf("host mapping %q → %q", source, target))
+	}
+
+	if r.scheme != "" && r.scheme != out.Scheme {
+		out.Scheme = r.scheme
+		trace.Rule("scheme", fmt.Sprintf("enforce scheme %q", r.scheme))
+	}
+
+	path := out.Path
+	for _, rewrite := range r.prefixes {
+		if strings.HasPrefix(path, rewrite.From) {
+			path = rewrite.To + strings.TrimPrefix(path, rewrite.From)
+			trace.Rule("path", fmt.Sprintf("path prefix rewrite %q → %q", rewrite.From, rewrite.To))
+			break
+		}
+	}
+
+	for _, rewrite := range r.regexes {
+		if rewritten := rewrite.pattern.ReplaceAllString(path, rewrite.replacement); rewritten != path {
+			path = rewritten
+			trace.Rule("path", fmt.Sprintf("regex rewrite %q → %q", rewrite.pattern, rewrite.replacement))
+		}
+	}
+
+	if lower := strings.ToLower(path); r.lowercase.Path && lower != path {
+		path = lower
+		trace.Rule("path", "lowercase path")
+	}
+
+	if path != out.Path {
+		out.Path = path
+		out.RawPath = ""
+	}
+
+	if lower := strings.ToLower(out.RawQuery); r.lowercase.Query && lower != out.RawQuery {
+		out.RawQuery = lower
+		trace.Rule("query", "lowercase query")
+	}
+
+	if lower := strings.ToLower(out.Fragment); r.lowercase.Fragment && lower != out.Fragment {
+		out.Fragment = lower
+		out.RawFragment = ""
+		trace.Rule("fragment", "lowercase fragment")
+	}
+
+	return &out
+}
+
+// mapHost picks the most specific mapping: exact host, then the longest
+// matching wildcard suffix, then the catch-all.
+func (r *Redirector) mapHost(host, hostname string) (target, source string, ok bool) {
+	if target, ok := r.exactHosts[host]; ok {
+		return target, host, true
+	}
+	if target, ok := r.exactHosts[hostname]; ok {
+		return target, hostname, true
+	}
+
+	best := ""
+	for suffix := range r.wildcardHosts {
+		if strings.HasSuffix(hostname, suffix) && len(suffix) > len(best) {
+			best = suffix
+		}
+	}
+	if best != "" {
+		return r.wildcardHosts[best], "*" + best, true
+	}
+
+	if r.defaultHost != "" {
+		return r.defaultHost, "*", true
+	}
+
+	return "", "", false
+}
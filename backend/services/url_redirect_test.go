@@ -0,0 +1,104 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+)
+
+func TestRedirectorApply(t *testing.T) {
+	rules := config.RedirectConfig{
+		HostMappings: map[string]string{
+			"*":                "www.byfood.com",
+			"old.example.com":  "new.example.com",
+			"*.example.com":    "www.example.com",
+			"*.eu.example.com": "eu.example.com",
+			"localhost:8080":   "localhost:9000",
+		},
+		Scheme: "https",
+		PathPrefixRewrites: []config.PathPrefixRewrite{
+			{From: "/blog/", To: "/articles/"},
+			{From: "/blog", To: "/news"},
+		},
+		RegexRewrites: []config.RegexRewrite{
+			{Pattern: `^/products/(\d+)$`, Replacement: "/p/$1"},
+		},
+		Lowercase: config.LowercaseComponents{Path: true},
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "catch-all host", in: "http://BYFOOD.com/About", want: "https://www.byfood.com/about"},
+		{name: "exact host wins over wildcard", in: "http://old.example.com/", want: "https://new.example.com/"},
+		{name: "wildcard host", in: "https://shop.example.com/x", want: "https://www.example.com/x"},
+		{name: "longest wildcard wins", in: "https://shop.eu.example.com/x", want: "https://eu.example.com/x"},
+		{name: "wildcard needs a subdomain", in: "https://example.com/x", want: "https://www.byfood.com/x"},
+		{name: "exact host with port", in: "http://localhost:8080/x", want: "https://localhost:9000/x"},
+		{name: "first matching prefix only", in: "https://www.byfood.com/blog/post", want: "https://www.byfood.com/articles/post"},
+		{name: "regex with capture group", in: "https://www.byfood.com/products/42", want: "https://www.byfood.com/p/42"},
+		{name: "query and fragment case kept", in: "https://www.byfood.com/A?Q=Yes#Top", want: "https://www.byfood.com/a?Q=Yes#Top"},
+	}
+
+	redirector, err := NewRedirector(rules)
+	if err != nil {
+		t.Fatalf("NewRedirector failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := redirector.Apply(u, nil).String(); got != tt.want {
+				t.Errorf("Apply(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectorRecordsRules(t *testing.T) {
+	redirector, err := NewRedirector(config.RedirectConfig{
+		HostMappings: map[string]string{"*": "www.byfood.com"},
+		Scheme:       "https",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("http://Example.com/")
+	trace := NewTrace()
+	redirector.Apply(u, trace)
+
+	rules := trace.rules
+	if len(rules["host"]) != 2 || len(rules["scheme"]) != 1 {
+		t.Errorf("recorded rules %v, want host lowercasing and mapping plus the scheme", rules)
+	}
+}
+
+func TestNewRedirectorRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules config.RedirectConfig
+	}{
+		{name: "invalid target host", rules: config.RedirectConfig{HostMappings: map[string]string{"*": "not a host"}}},
+		{name: "invalid source host", rules: config.RedirectConfig{HostMappings: map[string]string{"bad_host!": "a.com"}}},
+		{name: "invalid wildcard", rules: config.RedirectConfig{HostMappings: map[string]string{"*.": "a.com"}}},
+		{name: "unsupported scheme", rules: config.RedirectConfig{Scheme: "ftp"}},
+		{name: "relative prefix", rules: config.RedirectConfig{PathPrefixRewrites: []config.PathPrefixRewrite{{From: "blog", To: "/news"}}}},
+		{name: "invalid regex", rules: config.RedirectConfig{RegexRewrites: []config.RegexRewrite{{Pattern: "(", Replacement: ""}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRedirector(tt.rules); err == nil {
+				t.Error("NewRedirector succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrRedirectLoop   = errors.New("redirect loop detected")
+	ErrTooManyHops    = errors.New("too many redirects")
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	// ErrUnreachable is a destination that failed to answer properly.
+	ErrUnreachable = errors.New("destination unreachable")
+)
+
+// maxCanonicalScan bounds how much of an HTML page is read looking for
+// <link rel="canonical">.
+const maxCanonicalScan = 512 * 1024
+
+// cgnatRange is the carrier-grade NAT block, not covered by net.IP.IsPrivate.
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// ResolverOptions tunes how live URLs are followed.
+type ResolverOptions struct {
+	MaxHops int
+	Timeout time.Duration
+	// AllowPrivate permits loopback and private ranges, meant for tests only.
+	AllowPrivate    bool
+	FollowCanonical bool
+}
+
+// Resolver follows HTTP redirects and canonical links to find where a URL
+// really ends up.
+type Resolver struct {
+	opts   ResolverOptions
+	client *http.Client
+}
+
+func NewResolver(opts ResolverOptions) *Resolver {
+	return &Resolver{
+		opts: opts,
+		client: &http.Client{
+			Transport: NewPublicTransport(opts.Timeout, opts.AllowPrivate),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// NewPublicTransport returns a transport for fetching URLs users supplied,
+// it refuses to connect to loopback, private and link-local addresses with
+// ErrBlockedAddress unless allowPrivate is set, which is meant for tests.
+func NewPublicTransport(timeout time.Duration, allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// checked after DNS resolution so hostnames pointing at internal
+		// addresses are refused as well
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		// never go through an environment proxy, it would bypass the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+}
+
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnatRange.Contains(ip)
+}
+
+// Resolve follows rawURL until it stops redirecting and returns every hop.
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (entities.URLResolution, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return entities.URLResolution{}, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	resolution := entities.URLResolution{}
+	visited := make(map[string]bool)
+
+	for {
+		if visited[current.String()] {
+			return resolution, ErrRedirectLoop
+		}
+		visited[current.String()] = true
+
+		// every hop is a request, the final destination included
+		if len(resolution.Hops) >= r.opts.MaxHops {
+			return resolution, ErrTooManyHops
+		}
+
+		hop, next, err := r.fetch(ctx, current)
+		if err != nil {
+			return resolution, err
+		}
+		resolution.Hops = append(resolution.Hops, hop)
+
+		// a canonical link back to a page we've already seen ends the chain
+		if next == nil || (hop.Via == entities.HopViaCanonical && visited[next.String()]) {
+			resolution.Hops[len(resolution.Hops)-1].Via = ""
+			resolution.FinalURL = current.String()
+			return resolution, nil
+		}
+
+		current = next
+	}
+}
+
+// fetch requests u and returns the hop along with the next URL to visit,
+// next is nil when u is the final destination.
+func (r *Resolver) fetch(ctx context.Context, u *url.URL) (entities.URLHop, *url.URL, error) {
+	hop := entities.URLHop{URL: u.String()}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return hop, nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return hop, nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return hop, nil, fmt.Errorf("%w: request %s: %w", ErrUnreachable, u, err)
+	}
+	defer resp.Body.Close()
+
+	hop.StatusCode = resp.StatusCode
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location, err := resp.Location()
+		if err != nil {
+			return hop, nil, fmt.Errorf("%w: redirect from %s without a valid location", ErrUnreachable, u)
+		}
+		hop.Via = entities.HopViaRedirect
+		return hop, location, nil
+	}
+
+	if !r.opts.FollowCanonical || resp.StatusCode != http.StatusOK || !isHTML(resp.Header.Get("Content-Type")) {
+		return hop, nil, nil
+	}
+
+	canonical := findCanonical(io.LimitReader(resp.Body, maxCanonicalScan))
+	if canonical == "" {
+		return hop, nil, nil
+	}
+
+	next, err := u.Parse(canonical)
+	if err != nil || next.String() == u.String() {
+		return hop, nil, nil
+	}
+
+	hop.Via = entities.HopViaCanonical
+	return hop, next, nil
+}
+
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// findCanonical returns the href of the first <link rel="canonical"> found
+// before the document body.
+func findCanonical(r io.Reader) string {
+	tokenizer := html.NewTokenizer(r)
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+
+			if token.Data == "body" {
+				return ""
+			}
+			if token.Data != "link" {
+				continue
+			}
+
+			var rel, href string
+			for _, attr := range token.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "rel":
+					rel = attr.Val
+				case "href":
+					href = attr.Val
+				}
+			}
+
+			for _, value := range strings.Fields(strings.ToLower(rel)) {
+				if value == "canonical" {
+					return strings.TrimSpace(href)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+)
+
+// newRedirectChain serves /hop/N redirecting to /hop/N+1 until /hop/last,
+// /loop/a and /loop/b redirecting to each other, and /canonical pointing
+// at /hop/last through a <link rel="canonical">.
+func newRedirectChain(t *testing.T, last int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/hop/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hop/"))
+			if n < last {
+				http.Redirect(w, r, fmt.Sprintf("/hop/%d", n+1), http.StatusMovedPermanently)
+				return
+			}
+			w.Write([]byte("final"))
+		case r.URL.Path == "/loop/a":
+			http.Redirect(w, r, "/loop/b", http.StatusFound)
+		case r.URL.Path == "/loop/b":
+			http.Redirect(w, r, "/loop/a", http.StatusTemporaryRedirect)
+		case r.URL.Path == "/canonical":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, `<html><head><link rel="canonical" href="/hop/%d"></head><body></body></html>`, last)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func testResolver(maxHops int) *Resolver {
+	return NewResolver(ResolverOptions{MaxHops: maxHops, Timeout: 5 * time.Second, AllowPrivate: true, FollowCanonical: true})
+}
+
+func TestResolverFollowsChain(t *testing.T) {
+	server, _ := newRedirectChain(t, 3)
+
+	resolution, err := testResolver(10).Resolve(context.Background(), server.URL+"/hop/1")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if resolution.FinalURL != server.URL+"/hop/3" {
+		t.Errorf("final url = %s", resolution.FinalURL)
+	}
+	if len(resolution.Hops) != 3 {
+		t.Fatalf("got %d hops, want 3", len(resolution.Hops))
+	}
+	if hop := resolution.Hops[0]; hop.StatusCode != http.StatusMovedPermanently || hop.Via != entities.HopViaRedirect {
+		t.Errorf("first hop = %+v", hop)
+	}
+	if hop := resolution.Hops[2]; hop.StatusCode != http.StatusOK || hop.Via != "" {
+		t.Errorf("last hop = %+v", hop)
+	}
+}
+
+func TestResolverFollowsCanonical(t *testing.T) {
+	server, _ := newRedirectChain(t, 1)
+
+	resolution, err := testResolver(10).Resolve(context.Background(), server.URL+"/canonical")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if resolution.FinalURL != server.URL+"/hop/1" || resolution.Hops[0].Via != entities.HopViaCanonical {
+		t.Errorf("resolution = %+v", resolution)
+	}
+}
+
+func TestResolverDetectsLoop(t *testing.T) {
+	server, _ := newRedirectChain(t, 1)
+
+	resolution, err := testResolver(10).Resolve(context.Background(), server.URL+"/loop/a")
+	if !errors.Is(err, ErrRedirectLoop) {
+		t.Fatalf("err = %v, want ErrRedirectLoop", err)
+	}
+	if len(resolution.Hops) != 2 {
+		t.Errorf("got %d hops, want 2", len(resolution.Hops))
+	}
+}
+
+func TestResolverHopLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		last    int
+		wantErr error
+	}{
+		{name: "chain within the limit", last: 3},
+		{name: "chain over the limit", last: 4, wantErr: ErrTooManyHops},
+		{name: "long chain", last: 50, wantErr: ErrTooManyHops},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newRedirectChain(t, tt.last)
+
+			_, err := testResolver(3).Resolve(context.Background(), server.URL+"/hop/1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(requests); got > 3 {
+				t.Errorf("made %d requests, want at most 3", got)
+			}
+		})
+	}
+}
+
+func TestResolverBlocksPrivateAddresses(t *testing.T) {
+	server, requests := newRedirectChain(t, 1)
+	resolver := NewResolver(ResolverOptions{MaxHops: 10, Timeout: 5 * time.Second})
+
+	_, err := resolver.Resolve(context.Background(), server.URL+"/hop/1")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("err = %v, want ErrBlockedAddress", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 0 {
+		t.Errorf("loopback server got %d requests", got)
+	}
+}
@@ -1,50 +1,106 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
-	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/metrics"
+	"github.com/goesbams/mini-books-library/backend/utils"
 )
 
+// ErrInvalidURL marks failures caused by the URL given rather than by the
+// server, its message can be shown to the client.
+var ErrInvalidURL = errors.New("invalid url")
+
 type UrlServiceInterface interface {
-	ProcessUrl(rawURL, operation string) (string, error)
+	ProcessUrl(ctx context.Context, rawURL, operation string) (string, error)
+	ResolveUrl(ctx context.Context, rawURL string) (entities.URLResolution, error)
+	ExplainUrl(ctx context.Context, rawURL, operation string) (entities.URLExplanation, error)
+	ValidateRequest(req entities.URLRequest) error
+	Operations() []entities.URLOperationInfo
+}
+
+type UrlService struct {
+	registry *OperationRegistry
+	resolver *Resolver
+	validate *validator.Validate
 }
 
-type UrlService struct{}
+func NewUrlService(registry *OperationRegistry, resolver *Resolver) UrlServiceInterface {
+	validate := validator.New()
+	if err := registry.RegisterValidation(validate); err != nil {
+		// only fails on an invalid tag name, which is a programming error
+		panic(err)
+	}
+
+	return &UrlService{registry: registry, resolver: resolver, validate: validate}
+}
+
+// ValidateRequest checks the request fields, the operation must be one of
+// the registered operations or pipelines.
+func (s *UrlService) ValidateRequest(req entities.URLRequest) error {
+	if err := s.validate.Struct(req); err != nil {
+		return utils.FormatValidationError(err, req)
+	}
+
+	return nil
+}
+
+func (s *UrlService) Operations() []entities.URLOperationInfo {
+	return s.registry.List()
+}
 
-func NewUrlService() UrlServiceInterface {
-	return &UrlService{}
+// ResolveUrl follows the live redirect chain of rawURL.
+func (s *UrlService) ResolveUrl(ctx context.Context, rawURL string) (entities.URLResolution, error) {
+	resolution, err := s.resolver.Resolve(ctx, rawURL)
+	metrics.UrlOperation("resolve", err)
+	return resolution, err
 }
 
-func (s *UrlService) ProcessUrl(rawURL, operation string) (string, error) {
+func (s *UrlService) ProcessUrl(ctx context.Context, rawURL, operation string) (string, error) {
 	u, err := url.Parse(rawURL)
 	if err != nil {
-		return "", fmt.Errorf("invalid url: %w", err)
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
 	}
 
-	// Canonical: remove query params, trailing slash
-	canonical := func(u *url.URL) string {
-		u.RawQuery = ""
-		cleaned := strings.TrimSuffix(u.String(), "/")
-		return cleaned
+	op, ok := s.registry.Get(operation)
+	if !ok {
+		return "", fmt.Errorf("unsupported operation: %s", operation)
 	}
 
-	// Redirection: enforce www.byfood.com, lowercase
-	redirect := func(u *url.URL) string {
-		u.Host = "www.byfood.com"
-		return strings.ToLower(u.String())
+	processed, err := op.Apply(ctx, u, nil)
+	metrics.UrlOperation(operation, err)
+	if err != nil {
+		return "", err
 	}
 
-	switch operation {
-	case "canonical":
-		return canonical(u), nil
-	case "redirection":
-		return redirect(u), nil
-	case "all":
-		cleaned := canonical(u)
-		parsed, _ := url.Parse(cleaned)
-		return redirect(parsed), nil
-	default:
-		return "", fmt.Errorf("unsupported operation: %s", operation)
+	return processed.String(), nil
+}
+
+// ExplainUrl processes rawURL like ProcessUrl and also returns the URL after
+// every step along with the components each step changed. On failure the
+// steps that completed are still returned.
+func (s *UrlService) ExplainUrl(ctx context.Context, rawURL, operation string) (entities.URLExplanation, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return entities.URLExplanation{}, fmt.Errorf("%w: %w", ErrInvalidURL, err)
 	}
+
+	op, ok := s.registry.Get(operation)
+	if !ok {
+		return entities.URLExplanation{}, fmt.Errorf("unsupported operation: %s", operation)
+	}
+
+	trace := NewTrace()
+	processed, err := applyTraced(ctx, op, u, trace)
+	metrics.UrlOperation(operation, err)
+	if err != nil {
+		return entities.URLExplanation{Steps: trace.Steps()}, err
+	}
+
+	return entities.URLExplanation{FinalURL: processed.String(), Steps: trace.Steps()}, nil
 }
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+)
+
+type trackingRules struct {
+	exact        map[string]bool
+	prefixes     []string
+	allow        map[string]map[string]bool
+	sortParams   bool
+	dropFragment bool
+}
+
+// TrackingStripper removes tracking parameters from URLs while keeping the
+// meaningful ones. Its rules can be swapped at runtime with Update.
+type TrackingStripper struct {
+	rules atomic.Pointer[trackingRules]
+}
+
+func NewTrackingStripper(cfg config.TrackingConfig) *TrackingStripper {
+	s := &TrackingStripper{}
+	s.Update(cfg)
+	return s
+}
+
+// Update replaces the rules, requests in flight keep the previous set.
+func (s *TrackingStripper) Update(cfg config.TrackingConfig) {
+	rules := &trackingRules{
+		exact:        make(map[string]bool),
+		allow:        make(map[string]map[string]bool),
+		sortParams:   cfg.SortParams,
+		dropFragment: cfg.DropFragment,
+	}
+
+	for _, name := range cfg.DenyList {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			rules.prefixes = append(rules.prefixes, prefix)
+		} else if name != "" {
+			rules.exact[name] = true
+		}
+	}
+
+	for host, names := range cfg.AllowList {
+		allowed := make(map[string]bool, len(names))
+		for _, name := range names {
+			allowed[strings.ToLower(name)] = true
+		}
+		rules.allow[strings.ToLower(host)] = allowed
+	}
+
+	s.rules.Store(rules)
+}
+
+// Apply returns a copy of u without its tracking parameters, recording the
+// rules it applies on trace when one is given.
+func (s *TrackingStripper) Apply(u *url.URL, trace *Trace) *url.URL {
+	rules := s.rules.Load()
+	out := *u
+
+	allowed := rules.allow[strings.ToLower(u.Hostname())]
+
+	var params []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+
+		key, err := url.QueryUnescape(queryKey(param))
+		if err != nil {
+			key = queryKey(param)
+		}
+		key = strings.ToLower(key)
+
+		pattern, denied := rules.denied(key)
+		if allowed[key] || !denied {
+			params = append(params, param)
+			continue
+		}
+
+		trace.Rule("query:"+queryKey(param), fmt.Sprintf("tracking deny-list entry %q", pattern))
+	}
+
+	if rules.sortParams {
+		sort.SliceStable(params, func(i, j int) bool {
+			return queryKey(params[i]) < queryKey(params[j])
+		})
+		trace.Rule("query", "sort parameters")
+	}
+
+	out.RawQuery = strings.Join(params, "&")
+	out.ForceQuery = false
+
+	if rules.dropFragment {
+		out.Fragment, out.RawFragment = "", ""
+		trace.Rule("fragment", "drop fragment")
+	}
+
+	return &out
+}
+
+// denied reports whether key is a tracking parameter along with the
+// deny-list entry that matched it.
+func (r *trackingRules) denied(key string) (string, bool) {
+	if r.exact[key] {
+		return key, true
+	}
+
+	for _, prefix := range r.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix + "*", true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/goesbams/mini-books-library/backend/config"
+)
+
+func TestTrackingStripperApply(t *testing.T) {
+	rules := config.TrackingConfig{
+		DenyList: []string{"utm_*", "FBCLID", " ref ", "", "mc_*"},
+		AllowList: map[string][]string{
+			"Shop.example.com": {"ref", "UTM_campaign"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "prefix match", in: "https://example.com/?utm_source=x&utm_medium=y&page=2", want: "https://example.com/?page=2"},
+		{name: "prefix needs the whole prefix", in: "https://example.com/?utm=x&mc=y", want: "https://example.com/?utm=x&mc=y"},
+		{name: "names are case insensitive", in: "https://example.com/?UTM_Source=x&fbclid=y&FbClId=z", want: "https://example.com/"},
+		{name: "exact entries are trimmed", in: "https://example.com/?ref=x&referrer=y", want: "https://example.com/?referrer=y"},
+		{name: "escaped key", in: "https://example.com/?utm%5Fsource=x&q=a", want: "https://example.com/?q=a"},
+		{name: "allow list beats exact entry", in: "https://shop.example.com/?ref=x&fbclid=y", want: "https://shop.example.com/?ref=x"},
+		{name: "allow list beats prefix", in: "https://SHOP.example.com/?utm_campaign=x&utm_source=y", want: "https://SHOP.example.com/?utm_campaign=x"},
+		{name: "allow list is per host", in: "https://www.example.com/?ref=x&utm_campaign=y", want: "https://www.example.com/"},
+		{name: "order and values kept", in: "https://example.com/?b=2&utm_id=1&a=1&b=3", want: "https://example.com/?b=2&a=1&b=3"},
+		{name: "no query left", in: "https://example.com/path?#top", want: "https://example.com/path#top"},
+	}
+
+	stripper := NewTrackingStripper(rules)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stripper.Apply(u, nil).String(); got != tt.want {
+				t.Errorf("Apply(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackingStripperSortAndFragment(t *testing.T) {
+	stripper := NewTrackingStripper(config.TrackingConfig{DenyList: []string{"gclid"}, SortParams: true, DropFragment: true})
+
+	u, _ := url.Parse("https://example.com/?z=1&gclid=x&a=2&a=1#section")
+	if got, want := stripper.Apply(u, nil).String(), "https://example.com/?a=2&a=1&z=1"; got != want {
+		t.Errorf("Apply = %s, want %s", got, want)
+	}
+	if u.String() != "https://example.com/?z=1&gclid=x&a=2&a=1#section" {
+		t.Errorf("Apply changed its input to %s", u)
+	}
+}
+
+func TestTrackingStripperUpdate(t *testing.T) {
+	before := config.TrackingConfig{DenyList: []string{"utm_*"}}
+	after := config.TrackingConfig{DenyList: []string{"ref"}}
+	in, _ := url.Parse("https://example.com/?utm_source=a&ref=b")
+	wantBefore, wantAfter := "https://example.com/?ref=b", "https://example.com/?utm_source=a"
+
+	stripper := NewTrackingStripper(before)
+	if got := stripper.Apply(in, nil).String(); got != wantBefore {
+		t.Fatalf("Apply = %s, want %s", got, wantBefore)
+	}
+
+	// requests racing a reload see either rule set, never a mix of both
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if got := stripper.Apply(in, nil).String(); got != wantBefore && got != wantAfter {
+					t.Errorf("Apply during Update = %s", got)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		stripper.Update(after)
+		stripper.Update(before)
+	}
+	close(stop)
+	wg.Wait()
+
+	stripper.Update(after)
+	if got := stripper.Apply(in, nil).String(); got != wantAfter {
+		t.Errorf("Apply after Update = %s, want %s", got, wantAfter)
+	}
+}
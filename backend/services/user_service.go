@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/goesbams/mini-books-library/backend/auth"
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrEmailTaken = errors.New("a user with this email already exists")
+
+type UserServiceInterface interface {
+	GetUsers(ctx context.Context) ([]entities.User, error)
+	CreateUser(ctx context.Context, req *entities.CreateUserRequest) (entities.User, error)
+	UpdateUserRole(ctx context.Context, id int, req *entities.UpdateUserRoleRequest) error
+}
+
+type UserService struct {
+	repo repositories.UserRepositoryInterface
+	db   *sqlx.DB
+}
+
+func NewUserService(repo repositories.UserRepositoryInterface, db *sqlx.DB) UserServiceInterface {
+	return &UserService{repo: repo, db: db}
+}
+
+func (s *UserService) GetUsers(ctx context.Context) ([]entities.User, error) {
+	return s.repo.GetUsers(ctx, s.db)
+}
+
+// CreateUser registers a staff account, emails are stored lowercased.
+func (s *UserService) CreateUser(ctx context.Context, req *entities.CreateUserRequest) (entities.User, error) {
+	if err := req.Validate(); err != nil {
+		return entities.User{}, utils.FormatValidationError(err, req)
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return entities.User{}, err
+	}
+
+	user := entities.User{
+		Email:        strings.ToLower(strings.TrimSpace(req.Email)),
+		PasswordHash: hash,
+		Role:         req.Role,
+	}
+	if err := s.repo.CreateUser(ctx, s.db, &user); err != nil {
+		if errors.Is(err, repositories.ErrDuplicateEmail) {
+			return entities.User{}, ErrEmailTaken
+		}
+		return entities.User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateUserRole changes the role of a user, it applies to their next
+// access token, at the latest after one access token lifetime.
+func (s *UserService) UpdateUserRole(ctx context.Context, id int, req *entities.UpdateUserRoleRequest) error {
+	if err := req.Validate(); err != nil {
+		return utils.FormatValidationError(err, req)
+	}
+
+	return s.repo.UpdateUserRole(ctx, s.db, id, req.Role)
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobInfo describes a stored object.
+type BlobInfo struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore persists binary objects such as uploaded cover images under a
+// slash separated key.
+type BlobStore interface {
+	Put(key string, r io.Reader, contentType string) error
+	Get(key string) (io.ReadCloser, BlobInfo, error)
+	Delete(key string) error
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoreRejectsKeysOutsideRoot(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", ".", "..", "../secret", "covers/../../secret", "/etc/passwd"} {
+		if err := store.Put(key, strings.NewReader("x"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+		if _, _, err := store.Get(key); err == nil || errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+	}
+}
+
+func TestLocalStoreCleansKeys(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is cleaned but stays below the root
+	if err := store.Put("covers/./1/../1/original", strings.NewReader("cover"), "text/plain"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "covers", "1", "original")); err != nil {
+		t.Fatalf("blob not written where expected: %v", err)
+	}
+
+	r, info, err := store.Get("covers/1/original")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer r.Close()
+
+	content, _ := io.ReadAll(r)
+	if string(content) != "cover" || info.Size != 5 {
+		t.Errorf("got %q of size %d", content, info.Size)
+	}
+
+	// no temporary upload files are left behind
+	entries, _ := os.ReadDir(filepath.Join(root, "covers", "1"))
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want 1", len(entries))
+	}
+}
+
+func TestLocalStoreMissingBlob(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Get("covers/2/original"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get = %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete("covers/2/original"); err != nil {
+		t.Errorf("Delete of a missing blob = %v, want nil", err)
+	}
+}
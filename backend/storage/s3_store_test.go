@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+type s3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 is a stand-in for an S3 bucket, it checks the SigV4 signature of
+// every request the way the real service does.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]s3Object
+}
+
+func newFakeS3(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	s3 := &fakeS3{objects: make(map[string]s3Object)}
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !validSignature(r, body) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/covers/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = s3Object{data: body, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+	case http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Last-Modified", object.modTime.UTC().Format(http.TimeFormat))
+		w.Write(object.data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validSignature recomputes the signature from the request as received.
+func validSignature(r *http.Request, body []byte) bool {
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") || r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		return false
+	}
+
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host + "\nx-amz-content-sha256:" + sha256Hex(body) + "\nx-amz-date:" + amzDate + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		sha256Hex(body),
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), amzDate[:8])
+	for _, part := range []string{"us-east-1", "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return hmac.Equal([]byte(r.Header.Get("Authorization")), []byte(want))
+}
+
+func newTestS3Store(t *testing.T, endpoint, secretKey string) BlobStore {
+	t.Helper()
+
+	store, err := NewS3Store(S3Config{Endpoint: endpoint + "/", Bucket: "covers", AccessKey: testAccessKey, SecretKey: secretKey, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	server := newFakeS3(t)
+	store := newTestS3Store(t, server.URL, testSecretKey)
+
+	for _, key := range []string{"covers/7/original", "covers/7/small.jpg", "odd keys/ü+(1).jpg"} {
+		if err := store.Put(key, strings.NewReader("image of "+key), "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q) failed: %v", key, err)
+		}
+
+		blob, info, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) failed: %v", key, err)
+		}
+		data, _ := io.ReadAll(blob)
+		blob.Close()
+
+		if string(data) != "image of "+key || info.ContentType != "image/jpeg" || info.Size != int64(len(data)) || info.ModTime.IsZero() {
+			t.Errorf("Get(%q) = %q %+v", key, data, info)
+		}
+
+		if err := store.Delete(key); err != nil {
+			t.Fatalf("Delete(%q) failed: %v", key, err)
+		}
+		if _, _, err := store.Get(key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Get(%q) after Delete = %v, want ErrBlobNotFound", key, err)
+		}
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	server := newFakeS3(t)
+
+	forged := newTestS3Store(t, server.URL, "not the secret")
+	if err := forged.Put("covers/1/original", strings.NewReader("x"), "image/png"); err == nil {
+		t.Error("Put with a wrong secret succeeded")
+	}
+	if _, _, err := forged.Get("covers/1/original"); err == nil || errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get with a wrong secret = %v, want a storage error", err)
+	}
+
+	store := newTestS3Store(t, server.URL, testSecretKey)
+	for _, key := range []string{"", "/covers/1/original"} {
+		if err := store.Put(key, strings.NewReader("x"), "image/png"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+	}
+	if err := store.Delete("covers/never-stored"); err != nil {
+		t.Errorf("Delete of a missing blob = %v, want nil", err)
+	}
+}
+
+func TestNewS3StoreRequiresEndpointAndBucket(t *testing.T) {
+	if _, err := NewS3Store(S3Config{Bucket: "covers"}); err == nil {
+		t.Error("NewS3Store accepted a config without endpoint")
+	}
+	if _, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000"}); err == nil {
+		t.Error("NewS3Store accepted a config without bucket")
+	}
+}
@@ -0,0 +1,20 @@
+package tracing
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`([^$\w.]|^)\d+(?:\.\d+)?\b`)
+)
+
+// SanitizeSQL prepares a query to be recorded on a span: literals that may
+// hold user data are replaced by ? and whitespace is collapsed. Bind
+// parameters such as $1 and :title are kept.
+func SanitizeSQL(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	return strings.Join(strings.Fields(query), " ")
+}
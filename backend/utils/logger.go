@@ -1,12 +1,54 @@
 package utils
 
-import "github.com/sirupsen/logrus"
+import (
+	"context"
+	"fmt"
 
-func InitializeLogger() *logrus.Logger {
-	logger := logrus.New()
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
+	"github.com/goesbams/mini-books-library/backend/config"
+	"github.com/sirupsen/logrus"
+)
 
-	return logger
+type loggerKey struct{}
+
+// InitializeLogger configures the standard logrus logger, which the whole
+// backend logs through, and returns it.
+func InitializeLogger(cfg config.LogConfig) (*logrus.Logger, error) {
+	logger := logrus.StandardLogger()
+
+	switch cfg.Format {
+	case "", "text":
+		logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	if cfg.Level != "" {
+		level, err := logrus.ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		logger.SetLevel(level)
+	}
+
+	return logger, nil
+}
+
+// ContextWithLogger returns a copy of ctx carrying entry, code handling a
+// request logs through it so every line has the request's fields.
+func ContextWithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// LoggerFromContext returns the logger of ctx, or the standard logger when
+// ctx doesn't belong to a request.
+func LoggerFromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+
+	return logrus.NewEntry(logrus.StandardLogger())
 }
@@ -0,0 +1,257 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+)
+
+// CoverCheckerOptions tunes how the cover health check runs.
+type CoverCheckerOptions struct {
+	Interval        time.Duration
+	Timeout         time.Duration
+	Concurrency     int
+	PerHostInterval time.Duration
+	// Mirror downloads healthy remote covers into cover storage.
+	Mirror bool
+	// SkipPrefix excludes URLs that already point at our own cover endpoint
+	// from mirroring.
+	SkipPrefix string
+	// AllowPrivate lets covers be fetched from loopback and private
+	// addresses, meant for tests only.
+	AllowPrivate bool
+}
+
+// CoverChecker periodically verifies every book's cover_image_url.
+type CoverChecker struct {
+	bookRepo     repositories.BookRepositoryInterface
+	checkRepo    repositories.CoverCheckRepositoryInterface
+	coverService services.CoverServiceInterface
+	db           *sqlx.DB
+	client       *http.Client
+	opts         CoverCheckerOptions
+	limiter      *hostLimiter
+}
+
+func NewCoverChecker(bookRepo repositories.BookRepositoryInterface, checkRepo repositories.CoverCheckRepositoryInterface, coverService services.CoverServiceInterface, db *sqlx.DB, opts CoverCheckerOptions) *CoverChecker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	return &CoverChecker{
+		bookRepo:     bookRepo,
+		checkRepo:    checkRepo,
+		coverService: coverService,
+		db:           db,
+		// cover URLs come from users, they must not reach internal services
+		client:  &http.Client{Timeout: opts.Timeout, Transport: services.NewPublicTransport(opts.Timeout, opts.AllowPrivate)},
+		opts:    opts,
+		limiter: newHostLimiter(opts.PerHostInterval),
+	}
+}
+
+// Run checks all covers immediately and then on every interval until ctx is done.
+func (w *CoverChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.CheckAll(ctx); err != nil {
+			logrus.WithError(err).Error("cover check run failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs a single pass over every book that has a cover URL.
+func (w *CoverChecker) CheckAll(ctx context.Context) error {
+	books, err := w.bookRepo.GetBooks(ctx, w.db)
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, w.opts.Concurrency)
+	var wg sync.WaitGroup
+
+	for _, book := range books {
+		if book.CoverImageUrl == "" {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(book entities.Book) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			w.checkBook(ctx, book)
+		}(book)
+	}
+
+	wg.Wait()
+	logrus.Infof("checked covers of %d books", len(books))
+	return nil
+}
+
+func (w *CoverChecker) checkBook(ctx context.Context, book entities.Book) {
+	check := &entities.CoverCheck{
+		BookID:        book.ID,
+		CoverImageUrl: book.CoverImageUrl,
+	}
+
+	status, err := w.probe(ctx, book.CoverImageUrl)
+	check.StatusCode = status
+	check.Healthy = err == nil && status >= 200 && status < 300
+	check.CheckedAt = time.Now()
+	if err != nil {
+		check.Error = err.Error()
+	} else if !check.Healthy {
+		check.Error = http.StatusText(status)
+	}
+
+	if err := w.checkRepo.SaveCoverCheck(ctx, w.db, check); err != nil {
+		logrus.WithError(err).Errorf("failed to save cover check for book id:%d", book.ID)
+		return
+	}
+
+	if !check.Healthy {
+		logrus.Warnf("cover of book id:%d is broken status:%d url:%s", book.ID, status, book.CoverImageUrl)
+		return
+	}
+
+	if w.opts.Mirror && check.MirroredAt == nil && !w.isOwnCover(book.CoverImageUrl) {
+		if err := w.mirror(ctx, book); err != nil {
+			logrus.WithError(err).Warnf("failed to mirror cover of book id:%d", book.ID)
+		}
+	}
+}
+
+// probe issues a HEAD request, falling back to GET for servers that
+// don't implement HEAD.
+func (w *CoverChecker) probe(ctx context.Context, rawURL string) (int, error) {
+	status, err := w.request(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		return w.request(ctx, http.MethodGet, rawURL)
+	}
+
+	return status, err
+}
+
+func (w *CoverChecker) request(ctx context.Context, method, rawURL string) (int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return 0, fmt.Errorf("invalid cover url")
+	}
+
+	if err := w.limiter.wait(ctx, u.Host); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func (w *CoverChecker) mirror(ctx context.Context, book entities.Book) error {
+	u, err := url.Parse(book.CoverImageUrl)
+	if err != nil {
+		return err
+	}
+
+	if err := w.limiter.wait(ctx, u.Host); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, book.CoverImageUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := w.coverService.SaveCover(ctx, fmt.Sprint(book.ID), resp.Body); err != nil {
+		return err
+	}
+
+	logrus.Infof("mirrored cover of book id:%d", book.ID)
+	return w.checkRepo.MarkCoverMirrored(ctx, w.db, book.ID)
+}
+
+func (w *CoverChecker) isOwnCover(rawURL string) bool {
+	return w.opts.SkipPrefix != "" && strings.HasPrefix(rawURL, w.opts.SkipPrefix)
+}
+
+// hostLimiter spaces out requests to the same host by a fixed interval.
+type hostLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
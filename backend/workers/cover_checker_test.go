@@ -0,0 +1,222 @@
+package workers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/goesbams/mini-books-library/backend/entities"
+	"github.com/goesbams/mini-books-library/backend/repositories"
+	"github.com/goesbams/mini-books-library/backend/services"
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeBookRepo struct {
+	repositories.BookRepositoryInterface
+	books []entities.Book
+}
+
+func (r *fakeBookRepo) GetBooks(ctx context.Context, db *sqlx.DB) ([]entities.Book, error) {
+	return r.books, nil
+}
+
+// fakeCheckRepo keeps the latest check per book and which books were
+// mirrored, like the cover_checks table.
+type fakeCheckRepo struct {
+	repositories.CoverCheckRepositoryInterface
+
+	mu       sync.Mutex
+	checks   map[int]entities.CoverCheck
+	mirrored map[int]time.Time
+}
+
+func newFakeCheckRepo() *fakeCheckRepo {
+	return &fakeCheckRepo{checks: make(map[int]entities.CoverCheck), mirrored: make(map[int]time.Time)}
+}
+
+func (r *fakeCheckRepo) SaveCoverCheck(ctx context.Context, db *sqlx.DB, check *entities.CoverCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[check.BookID] = *check
+	if at, ok := r.mirrored[check.BookID]; ok {
+		check.MirroredAt = &at
+	}
+	return nil
+}
+
+func (r *fakeCheckRepo) MarkCoverMirrored(ctx context.Context, db *sqlx.DB, bookID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mirrored[bookID] = time.Now()
+	return nil
+}
+
+type fakeCoverService struct {
+	services.CoverServiceInterface
+
+	mu    sync.Mutex
+	saved map[string]string
+}
+
+func (s *fakeCoverService) SaveCover(ctx context.Context, id string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved[id] = string(data)
+	return nil
+}
+
+// newCoverServer serves /cover.jpg and /books/3/cover, a 404 at /gone.jpg and /no-head.jpg
+// which only answers GET.
+func newCoverServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch r.URL.Path {
+		case "/cover.jpg", "/books/3/cover":
+			w.Write([]byte("cover bytes"))
+		case "/no-head.jpg":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte("cover bytes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func newTestChecker(books []entities.Book, opts CoverCheckerOptions) (*CoverChecker, *fakeCheckRepo, *fakeCoverService) {
+	checks := newFakeCheckRepo()
+	covers := &fakeCoverService{saved: make(map[string]string)}
+	opts.Timeout = 5 * time.Second
+	opts.Concurrency = 2
+
+	return NewCoverChecker(&fakeBookRepo{books: books}, checks, covers, nil, opts), checks, covers
+}
+
+func TestCoverCheckerRecordsStatus(t *testing.T) {
+	server, _ := newCoverServer(t)
+	books := []entities.Book{
+		{ID: 1, CoverImageUrl: server.URL + "/cover.jpg"},
+		{ID: 2, CoverImageUrl: server.URL + "/gone.jpg"},
+		{ID: 3, CoverImageUrl: server.URL + "/no-head.jpg"},
+		{ID: 4, CoverImageUrl: "not a url"},
+		{ID: 5},
+	}
+	checker, checks, _ := newTestChecker(books, CoverCheckerOptions{AllowPrivate: true})
+
+	if err := checker.CheckAll(context.Background()); err != nil {
+		t.Fatalf("CheckAll failed: %v", err)
+	}
+
+	tests := []struct {
+		bookID     int
+		wantStatus int
+		wantHealth bool
+	}{
+		{bookID: 1, wantStatus: http.StatusOK, wantHealth: true},
+		{bookID: 2, wantStatus: http.StatusNotFound},
+		{bookID: 3, wantStatus: http.StatusOK, wantHealth: true},
+		{bookID: 4},
+	}
+	for _, tt := range tests {
+		check, ok := checks.checks[tt.bookID]
+		if !ok {
+			t.Errorf("book %d not checked", tt.bookID)
+			continue
+		}
+		if check.StatusCode != tt.wantStatus || check.Healthy != tt.wantHealth || (check.Error == "") != tt.wantHealth {
+			t.Errorf("book %d check = %+v, want status %d healthy %v", tt.bookID, check, tt.wantStatus, tt.wantHealth)
+		}
+	}
+	if _, ok := checks.checks[5]; ok {
+		t.Error("book without a cover checked")
+	}
+}
+
+func TestCoverCheckerBlocksInternalAddresses(t *testing.T) {
+	server, requests := newCoverServer(t)
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL+"/cover.jpg", http.StatusFound))
+	defer redirect.Close()
+
+	books := []entities.Book{
+		{ID: 1, CoverImageUrl: server.URL + "/cover.jpg"},
+		{ID: 2, CoverImageUrl: "http://169.254.169.254/latest/meta-data/"},
+		{ID: 3, CoverImageUrl: redirect.URL},
+	}
+	checker, checks, covers := newTestChecker(books, CoverCheckerOptions{Mirror: true})
+
+	if err := checker.CheckAll(context.Background()); err != nil {
+		t.Fatalf("CheckAll failed: %v", err)
+	}
+
+	for _, book := range books {
+		check := checks.checks[book.ID]
+		if check.Healthy || !strings.Contains(check.Error, services.ErrBlockedAddress.Error()) {
+			t.Errorf("book %d check = %+v, want the address refused", book.ID, check)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 0 {
+		t.Errorf("loopback server got %d requests", got)
+	}
+	if len(covers.saved) != 0 {
+		t.Errorf("mirrored %d covers from internal addresses", len(covers.saved))
+	}
+}
+
+func TestCoverCheckerMirrorsHealthyCovers(t *testing.T) {
+	server, _ := newCoverServer(t)
+	books := []entities.Book{
+		{ID: 1, CoverImageUrl: server.URL + "/cover.jpg"},
+		{ID: 2, CoverImageUrl: server.URL + "/gone.jpg"},
+		{ID: 3, CoverImageUrl: server.URL + "/books/3/cover"},
+	}
+	checker, checks, covers := newTestChecker(books, CoverCheckerOptions{
+		Mirror:       true,
+		SkipPrefix:   server.URL + "/books/",
+		AllowPrivate: true,
+	})
+
+	if err := checker.CheckAll(context.Background()); err != nil {
+		t.Fatalf("CheckAll failed: %v", err)
+	}
+
+	if covers.saved["1"] != "cover bytes" {
+		t.Errorf("healthy cover saved as %q", covers.saved["1"])
+	}
+	if _, ok := checks.mirrored[1]; !ok {
+		t.Error("healthy cover not marked mirrored")
+	}
+	if len(covers.saved) != 1 {
+		t.Errorf("saved covers %v, want only the healthy remote one", covers.saved)
+	}
+
+	// a mirrored cover isn't downloaded again
+	covers.saved = make(map[string]string)
+	if err := checker.CheckAll(context.Background()); err != nil {
+		t.Fatalf("CheckAll failed: %v", err)
+	}
+	if len(covers.saved) != 0 {
+		t.Errorf("mirrored again: %v", covers.saved)
+	}
+}